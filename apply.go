@@ -0,0 +1,292 @@
+package kubernetes
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/yaml"
+)
+
+const defaultFieldManager = "cg-controller"
+
+type ApplyOptions struct {
+	// FieldManager used for server-side apply, "cg-controller" when empty.
+	FieldManager string
+	// DryRun sends the apply with DryRun=All and reports the diff against
+	// the live objects instead of changing the cluster.
+	DryRun bool
+	// Release labels every object with ReleaseLabel and records them in the
+	// inventory of that release, kept in ReleaseNamespace ("default" when empty).
+	Release          string
+	ReleaseNamespace string
+	// Prune deletes the objects recorded in the previous revision of Release
+	// that are no longer in the manifests. Only kinds in PruneKinds, or
+	// DefaultPruneKinds when empty, are deleted. DryRun previews the deletions.
+	Prune      bool
+	PruneKinds []schema.GroupKind
+	// ConfigChecksum stamps ConfigChecksumAnnotation on the pod templates of
+	// Deployments, StatefulSets and DaemonSets, so their pods roll when a
+	// ConfigMap or Secret they use changes. Config in the same manifests is
+	// taken as applied. RolloutConfigDependents updates the annotation as
+	// the default FieldManager, keep it when both are used.
+	ConfigChecksum bool
+}
+
+type ApplyResult struct {
+	GVK       schema.GroupVersionKind
+	Namespace string
+	Name      string
+	Object    *unstructured.Unstructured // as returned by the server
+	Diff      []FieldChange              // only set for dry runs
+	Err       error
+}
+
+type ApplyReport struct {
+	Results []ApplyResult
+	Pruned  []ApplyResult // objects deleted, or that would be on dry runs, by Prune
+}
+
+func (r *ApplyReport) Failed() []ApplyResult {
+	var failed []ApplyResult
+	for _, result := range append(append([]ApplyResult{}, r.Results...), r.Pruned...) {
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// Err aggregates the errors of all failed objects, nil when everything applied.
+func (r *ApplyReport) Err() error {
+	var errs []error
+	for _, result := range r.Failed() {
+		errs = append(errs, result.Err)
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// DecodeManifests splits a `---` separated YAML (or JSON) stream into objects,
+// expanding List kinds and skipping empty documents.
+func DecodeManifests(manifests YAML) ([]*unstructured.Unstructured, error) {
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(strings.NewReader(manifests)))
+	var objs []*unstructured.Unstructured
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var content map[string]interface{}
+		if err := yaml.Unmarshal(doc, &content); err != nil {
+			return nil, decodeError(err)
+		}
+		if len(content) == 0 {
+			continue
+		}
+
+		obj, err := decodeObject(string(doc))
+		if err != nil {
+			return nil, err
+		}
+		if !obj.IsList() {
+			objs = append(objs, obj)
+			continue
+		}
+		err = obj.EachListItem(func(item runtime.Object) error {
+			objs = append(objs, item.(*unstructured.Unstructured))
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return objs, nil
+}
+
+// SortByInstallOrder orders objects by InstallOrder, keeping stream order within a kind.
+func SortByInstallOrder(objs []*unstructured.Unstructured) {
+	sort.SliceStable(objs, func(i, j int) bool {
+		return installOrderIndex(objs[i].GetKind()) < installOrderIndex(objs[j].GetKind())
+	})
+}
+
+// ApplyDynamicUnstructured applies every object of a multi-document manifest.
+// Objects are applied in InstallOrder and a failure does not stop the remaining
+// objects; check the report for per-object results.
+func (c *KubernetesClient) ApplyDynamicUnstructured(ctx context.Context, manifests YAML, opts ApplyOptions) (*ApplyReport, error) {
+	if opts.Prune && opts.Release == "" {
+		return nil, errPruneNeedsRelease
+	}
+	releaseNamespace := opts.ReleaseNamespace
+	if releaseNamespace == "" {
+		releaseNamespace = metav1.NamespaceDefault
+	}
+
+	objs, err := DecodeManifests(manifests)
+	if err != nil {
+		return nil, err
+	}
+	SortByInstallOrder(objs)
+	if opts.Release != "" {
+		for _, obj := range objs {
+			labels := obj.GetLabels()
+			obj.SetLabels(setKey(labels, ReleaseLabel, opts.Release))
+		}
+	}
+
+	report := &ApplyReport{}
+	var applied []ObjectRef
+	configs := map[ObjectRef]*unstructured.Unstructured{}
+	for _, obj := range objs {
+		// before the ref is built, it has to match the one recorded in the release
+		c.defaultNamespace(obj)
+		var result ApplyResult
+		if opts.ConfigChecksum {
+			result.Err = c.stampConfigChecksum(ctx, obj, configs)
+		}
+		switch {
+		case result.Err != nil:
+			// the checksum failed, the object is not applied without it
+		case opts.DryRun:
+			result.Object, result.Diff, result.Err = c.diffObject(ctx, obj, opts)
+		default:
+			result.Object, result.Err = c.applyObject(ctx, obj, opts)
+		}
+		result.GVK = obj.GroupVersionKind()
+		result.Namespace = obj.GetNamespace()
+		result.Name = obj.GetName()
+		report.Results = append(report.Results, result)
+		gvk := obj.GroupVersionKind()
+		ref := ObjectRef{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind, Namespace: result.Namespace, Name: result.Name}
+		applied = append(applied, ref)
+		if result.Object != nil && ref.Group == "" && (ref.Kind == ConfigMapKind || ref.Kind == SecretKind) {
+			configs[ref] = result.Object
+		}
+	}
+
+	// the ref of a failed object may not match the recorded one, pruning
+	// could then delete an object that is still in the manifests
+	if failed := len(report.Failed()); opts.Prune && failed > 0 {
+		fmt.Printf("Not pruning, %d objects failed\n", failed)
+	} else if opts.Prune {
+		report.Pruned, err = c.prune(ctx, releaseNamespace, applied, opts)
+		if err != nil {
+			return report, err
+		}
+	}
+
+	if opts.DryRun {
+		fmt.Printf("Dry run of %d objects, %d pruned, %d failed\n", len(report.Results), len(report.Pruned), len(report.Failed()))
+		return report, nil
+	}
+	fmt.Printf("Applied %d objects, %d pruned, %d failed\n", len(report.Results), len(report.Pruned), len(report.Failed()))
+
+	if opts.Release != "" {
+		if err := c.recordRelease(ctx, releaseNamespace, opts.Release, report); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+func (c *KubernetesClient) applyObject(ctx context.Context, obj *unstructured.Unstructured, opts ApplyOptions) (*unstructured.Unstructured, error) {
+	dr, err := c.resourceFor(obj)
+	if err != nil {
+		return nil, objectError("apply", obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName(), err)
+	}
+
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, objectError("apply", obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName(), err)
+	}
+
+	fieldManager := opts.FieldManager
+	if fieldManager == "" {
+		fieldManager = defaultFieldManager
+	}
+	patchOptions := metav1.PatchOptions{
+		FieldManager: fieldManager,
+	}
+	if opts.DryRun {
+		patchOptions.DryRun = []string{metav1.DryRunAll}
+	}
+	result, err := dr.Patch(ctx, obj.GetName(), types.ApplyPatchType, data, patchOptions)
+	if err != nil {
+		return nil, objectError("apply", obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName(), err)
+	}
+	return result, nil
+}
+
+// diffObject dry-runs the apply of obj and diffs the would-be object against the live one.
+func (c *KubernetesClient) diffObject(ctx context.Context, obj *unstructured.Unstructured, opts ApplyOptions) (*unstructured.Unstructured, []FieldChange, error) {
+	dr, err := c.resourceFor(obj)
+	if err != nil {
+		return nil, nil, objectError("diff", obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName(), err)
+	}
+	live, err := dr.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	if err != nil && !IsNotFound(err) {
+		return nil, nil, objectError("diff", obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName(), err)
+	}
+	if err != nil {
+		live = nil
+	}
+
+	opts.DryRun = true
+	result, err := c.applyObject(ctx, obj, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, DiffUnstructured(live, result), nil
+}
+
+// defaultNamespace sets the default namespace on namespaced objects that do
+// not set one. Objects of unknown kinds are taken as namespaced, they fail to
+// apply anyway.
+func (c *KubernetesClient) defaultNamespace(obj *unstructured.Unstructured) {
+	if obj.GetNamespace() != "" {
+		return
+	}
+	mapping, err := c.restMapping(obj.GroupVersionKind())
+	if err != nil || mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		obj.SetNamespace(metav1.NamespaceDefault)
+	}
+}
+
+// resourceFor maps obj to its dynamic resource, defaulting the namespace of
+// namespaced objects that do not set one.
+func (c *KubernetesClient) resourceFor(obj *unstructured.Unstructured) (dynamic.ResourceInterface, error) {
+	mapping, err := c.restMapping(obj.GroupVersionKind())
+	if err != nil {
+		return nil, err
+	}
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace && obj.GetNamespace() == "" {
+		obj.SetNamespace(metav1.NamespaceDefault)
+	}
+	return c.resourceInterface(mapping, obj.GetNamespace()), nil
+}
+
+func (c *KubernetesClient) resourceInterface(mapping *meta.RESTMapping, namespace string) dynamic.ResourceInterface {
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		// namespaced resources should specify the namespace
+		return c.dynamicinterface.Resource(mapping.Resource).Namespace(namespace)
+	}
+	// for cluster-wide resources
+	return c.dynamicinterface.Resource(mapping.Resource)
+}
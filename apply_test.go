@@ -0,0 +1,73 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testManifests = `
+# leading comment only document
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: web-config
+- apiVersion: v1
+  kind: Service
+  metadata:
+    name: web
+---
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: web
+`
+
+func TestDecodeManifests(t *testing.T) {
+	objs, err := DecodeManifests(testManifests)
+
+	assert.Nil(t, err)
+	assert.Len(t, objs, 4)
+	assert.Equal(t, DeploymentKind, objs[0].GetKind())
+	assert.Equal(t, "web-config", objs[1].GetName())
+}
+
+func TestDecodeManifestsInvalid(t *testing.T) {
+	_, err := DecodeManifests("apiVersion: v1\nmetadata:\n  name: no-kind\n")
+
+	assert.NotNil(t, err)
+}
+
+func TestSortByInstallOrder(t *testing.T) {
+	objs, err := DecodeManifests(testManifests + TestdeploymentYAMLRedis)
+	assert.Nil(t, err)
+
+	SortByInstallOrder(objs)
+
+	var kinds []string
+	for _, obj := range objs {
+		kinds = append(kinds, obj.GetKind())
+	}
+	assert.Equal(t, NamespaceKind, kinds[0])
+	assert.Equal(t, ServiceAccountKind, kinds[1])
+	assert.Equal(t, SecretKind, kinds[2])
+	assert.Equal(t, StatefulSetKind, kinds[len(kinds)-1])
+	assert.Less(t, installOrderIndex(ConfigMapKind), installOrderIndex(DeploymentKind))
+}
+
+func TestApplyPruneNeedsRelease(t *testing.T) {
+	_, err := (&KubernetesClient{}).ApplyDynamicUnstructured(context.Background(), testManifests, ApplyOptions{Prune: true})
+
+	assert.Equal(t, errPruneNeedsRelease, err)
+}
@@ -0,0 +1,348 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type BackendCheckType string
+
+const (
+	BackendCheckTCP  BackendCheckType = "tcp"  // the port accepts connections
+	BackendCheckHTTP BackendCheckType = "http" // GET Path answers 200-399
+)
+
+const (
+	defaultBackendInterval     = 10 * time.Second
+	defaultBackendCheckTimeout = 2 * time.Second
+)
+
+// BackendCheck is how backends are probed. Like kubelet probes a backend
+// starts unhealthy, turns healthy after HealthyThreshold successes in a row
+// and unhealthy again after UnhealthyThreshold failures in a row.
+type BackendCheck struct {
+	Type               BackendCheckType // defaults to tcp
+	Path               string           // http only, defaults to "/"
+	Timeout            time.Duration    // defaults to 2s
+	HealthyThreshold   int              // defaults to 1
+	UnhealthyThreshold int              // defaults to 3
+}
+
+type ExternalBackendsOptions struct {
+	PortName string
+	Protocol v1.Protocol // defaults to TCP
+	Check    BackendCheck
+	Interval time.Duration // between checks, defaults to 10s
+
+	// LegacyEndpoints writes a v1 Endpoints named after the service instead
+	// of EndpointSlices, e.g. for the db_endpoint of CreateApplicationService.
+	// Backends must then be IPs.
+	LegacyEndpoints bool
+}
+
+type BackendStatus struct {
+	Backend     string // host:port
+	Healthy     bool
+	LastChecked time.Time
+	LastError   error // of the last check, nil when it passed
+}
+
+type backendState struct {
+	host      string
+	status    BackendStatus
+	successes int
+	failures  int
+}
+
+// ExternalBackends keeps the endpoints of a service without selector
+// pointing at the healthy ones of a set of backends outside the cluster.
+type ExternalBackends struct {
+	client    *KubernetesClient
+	namespace string
+	service   string
+	options   ExternalBackendsOptions
+	http      *http.Client
+
+	mu         sync.Mutex
+	port       int32
+	backends   map[string]*backendState
+	synced     []string // healthy hosts last written, nil before the first sync
+	syncedPort int32    // port last written
+}
+
+// NewExternalBackends manages the endpoints of service for backends given as
+// host:port. All backends share one port, a service port maps to one target.
+func (c *KubernetesClient) NewExternalBackends(namespace string, service string, backends []string, opts ExternalBackendsOptions) (*ExternalBackends, error) {
+	if opts.Protocol == "" {
+		opts.Protocol = v1.ProtocolTCP
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = defaultBackendInterval
+	}
+	check := &opts.Check
+	if check.Type == "" {
+		check.Type = BackendCheckTCP
+	}
+	if check.Type != BackendCheckTCP && check.Type != BackendCheckHTTP {
+		return nil, fmt.Errorf("unknown backend check %q", check.Type)
+	}
+	if check.Path == "" {
+		check.Path = "/"
+	}
+	if check.Timeout <= 0 {
+		check.Timeout = defaultBackendCheckTimeout
+	}
+	if check.HealthyThreshold <= 0 {
+		check.HealthyThreshold = 1
+	}
+	if check.UnhealthyThreshold <= 0 {
+		check.UnhealthyThreshold = 3
+	}
+
+	b := &ExternalBackends{
+		client:    c,
+		namespace: namespace,
+		service:   service,
+		options:   opts,
+		http: &http.Client{
+			Timeout: check.Timeout,
+			// a redirect answers the check, it is not followed
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}
+	if err := b.SetBackends(backends); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// SetBackends replaces the backends, the state of those already known is kept.
+// The endpoints change with the next check.
+func (b *ExternalBackends) SetBackends(backends []string) error {
+	states := map[string]*backendState{}
+	var port int32
+	for _, backend := range backends {
+		host, portString, err := net.SplitHostPort(backend)
+		if err != nil {
+			return fmt.Errorf("backend %q: %w", backend, err)
+		}
+		p, err := strconv.ParseInt(portString, 10, 32)
+		if err != nil || p <= 0 || p > 65535 {
+			return fmt.Errorf("backend %q: invalid port %q", backend, portString)
+		}
+		if port != 0 && int32(p) != port {
+			return fmt.Errorf("backend %q: all backends need port %d", backend, port)
+		}
+		port = int32(p)
+		addressType, err := AddressTypeOf(host)
+		if err != nil {
+			return fmt.Errorf("backend %q: %w", backend, err)
+		}
+		if b.options.LegacyEndpoints && net.ParseIP(host) == nil {
+			return fmt.Errorf("backend %q: Endpoints only take IPs, not %s", backend, addressType)
+		}
+		states[backend] = &backendState{host: host, status: BackendStatus{Backend: backend}}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for backend, state := range b.backends {
+		if _, ok := states[backend]; ok {
+			states[backend] = state
+		}
+	}
+	b.backends = states
+	if port != 0 {
+		b.port = port
+	}
+	return nil
+}
+
+// Status returns the state of every backend, sorted by backend.
+func (b *ExternalBackends) Status() []BackendStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var statuses []BackendStatus
+	for _, state := range b.backends {
+		statuses = append(statuses, state.status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Backend < statuses[j].Backend })
+	return statuses
+}
+
+// CheckOnce probes all backends concurrently and writes the endpoints when
+// the set of healthy backends or their port changed, or on the first call.
+func (b *ExternalBackends) CheckOnce(ctx context.Context) error {
+	b.mu.Lock()
+	backends := make(map[string]*backendState, len(b.backends))
+	for backend, state := range b.backends {
+		backends[backend] = state
+	}
+	b.mu.Unlock()
+
+	results := make(map[string]error, len(backends))
+	var resultsMu sync.Mutex
+	var wg sync.WaitGroup
+	for backend := range backends {
+		wg.Add(1)
+		go func(backend string) {
+			defer wg.Done()
+			err := b.probe(ctx, backend)
+			resultsMu.Lock()
+			results[backend] = err
+			resultsMu.Unlock()
+		}(backend)
+	}
+	wg.Wait()
+
+	b.mu.Lock()
+	check := b.options.Check
+	now := time.Now()
+	for backend, err := range results {
+		state, ok := b.backends[backend]
+		if !ok {
+			continue // removed by SetBackends meanwhile
+		}
+		state.status.LastChecked = now
+		state.status.LastError = err
+		if err == nil {
+			state.successes, state.failures = state.successes+1, 0
+			if !state.status.Healthy && state.successes >= check.HealthyThreshold {
+				state.status.Healthy = true
+				fmt.Printf("Backend %s of service %s is healthy\n", backend, b.service)
+			}
+		} else {
+			state.successes, state.failures = 0, state.failures+1
+			if state.status.Healthy && state.failures >= check.UnhealthyThreshold {
+				state.status.Healthy = false
+				fmt.Printf("Backend %s of service %s is unhealthy: %v\n", backend, b.service, err)
+			}
+		}
+	}
+	healthy := []string{}
+	for _, state := range b.backends {
+		if state.status.Healthy {
+			healthy = append(healthy, state.host)
+		}
+	}
+	sort.Strings(healthy)
+	changed := b.synced == nil || b.syncedPort != b.port || !equalStrings(b.synced, healthy)
+	port := b.port
+	b.mu.Unlock()
+
+	if !changed {
+		return nil
+	}
+	if err := b.sync(ctx, port, healthy); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.synced, b.syncedPort = healthy, port
+	b.mu.Unlock()
+	return nil
+}
+
+// Run checks the backends every interval until ctx is done. Failed endpoint
+// updates are printed and retried with the next check.
+func (b *ExternalBackends) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.options.Interval)
+	defer ticker.Stop()
+	for {
+		if err := b.CheckOnce(ctx); err != nil && ctx.Err() == nil {
+			fmt.Printf("Updating backends of service %s failed: %v\n", b.service, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (b *ExternalBackends) probe(ctx context.Context, backend string) error {
+	check := b.options.Check
+	ctx, cancel := context.WithTimeout(ctx, check.Timeout)
+	defer cancel()
+
+	if check.Type == BackendCheckTCP {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", backend)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+backend+check.Path, nil)
+	if err != nil {
+		return err
+	}
+	response, err := b.http.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 400 {
+		return fmt.Errorf("GET %s: %s", check.Path, response.Status)
+	}
+	return nil
+}
+
+func (b *ExternalBackends) sync(ctx context.Context, port int32, hosts []string) error {
+	ports := []EndpointPortSpec{{Name: b.options.PortName, Protocol: b.options.Protocol, Port: port}}
+	if !b.options.LegacyEndpoints {
+		var backends []EndpointBackend
+		for _, host := range hosts {
+			backends = append(backends, EndpointBackend{Address: host})
+		}
+		return b.client.SyncServiceBackends(ctx, b.namespace, b.service, ports, backends)
+	}
+	return b.client.syncEndpoints(ctx, b.namespace, b.service, ports[0], hosts)
+}
+
+// syncEndpoints sets the addresses of the v1 Endpoints name, creating it when missing.
+func (c *KubernetesClient) syncEndpoints(ctx context.Context, namespace string, name string, port EndpointPortSpec, ips []string) error {
+	gvk := v1.SchemeGroupVersion.WithKind("Endpoints")
+	var subsets []v1.EndpointSubset
+	if len(ips) > 0 {
+		subset := v1.EndpointSubset{Ports: []v1.EndpointPort{{Name: port.Name, Port: port.Port, Protocol: port.Protocol}}}
+		for _, ip := range ips {
+			subset.Addresses = append(subset.Addresses, v1.EndpointAddress{IP: ip})
+		}
+		subsets = append(subsets, subset)
+	}
+
+	endpointsClient := c.clientset.CoreV1().Endpoints(namespace)
+	endpoints, err := endpointsClient.Get(ctx, name, metav1.GetOptions{})
+	if IsNotFound(err) {
+		_, err = endpointsClient.Create(ctx, &v1.Endpoints{ObjectMeta: metav1.ObjectMeta{Name: name}, Subsets: subsets}, metav1.CreateOptions{})
+		return objectError("create", gvk, namespace, name, err)
+	}
+	if err != nil {
+		return objectError("get", gvk, namespace, name, err)
+	}
+	endpoints.Subsets = subsets
+	_, err = endpointsClient.Update(ctx, endpoints, metav1.UpdateOptions{})
+	return objectError("update", gvk, namespace, name, err)
+}
+
+func equalStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,172 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newSelectorlessServiceCluster() *fakeCluster {
+	return newFakeCluster(&v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default"}})
+}
+
+func TestExternalBackendsTCP(t *testing.T) {
+	cluster := newSelectorlessServiceCluster()
+	ctx := context.Background()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	up := listener.Addr().String()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	// same port on another loopback address, nobody listens there
+	_, port, _ := net.SplitHostPort(up)
+	down := net.JoinHostPort("127.0.0.2", port)
+
+	backends, err := cluster.client.NewExternalBackends("default", "db", []string{up, down}, ExternalBackendsOptions{
+		PortName: "postgres",
+		Check:    BackendCheck{Timeout: time.Second, UnhealthyThreshold: 2},
+	})
+	assert.Nil(t, err)
+
+	assert.Nil(t, backends.CheckOnce(ctx))
+	slice, err := cluster.clientset.DiscoveryV1().EndpointSlices("default").Get(ctx, "db-ipv4", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Len(t, slice.Endpoints, 1)
+	assert.Equal(t, []string{"127.0.0.1"}, slice.Endpoints[0].Addresses)
+	assert.Equal(t, "postgres", *slice.Ports[0].Name)
+	status := backends.Status()
+	assert.True(t, status[0].Healthy)
+	assert.False(t, status[1].Healthy)
+	assert.NotNil(t, status[1].LastError)
+
+	// one failure is tolerated, the second one takes the backend out
+	listener.Close()
+	assert.Nil(t, backends.CheckOnce(ctx))
+	assert.True(t, backends.Status()[0].Healthy)
+	assert.Nil(t, backends.CheckOnce(ctx))
+	assert.False(t, backends.Status()[0].Healthy)
+	slices, err := cluster.client.ListServiceEndpointSlices(ctx, "default", "db")
+	assert.Nil(t, err)
+	assert.Empty(t, slices.Items)
+}
+
+func TestExternalBackendsPortChange(t *testing.T) {
+	cluster := newSelectorlessServiceCluster()
+	ctx := context.Background()
+
+	var addresses []string
+	for i := 0; i < 2; i++ {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(t, err)
+		defer listener.Close()
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				conn.Close()
+			}
+		}()
+		addresses = append(addresses, listener.Addr().String())
+	}
+	slicePort := func() int32 {
+		slice, err := cluster.clientset.DiscoveryV1().EndpointSlices("default").Get(ctx, "db-ipv4", metav1.GetOptions{})
+		assert.Nil(t, err)
+		return *slice.Ports[0].Port
+	}
+
+	backends, err := cluster.client.NewExternalBackends("default", "db", addresses[:1], ExternalBackendsOptions{})
+	assert.Nil(t, err)
+	assert.Nil(t, backends.CheckOnce(ctx))
+	_, first, _ := net.SplitHostPort(addresses[0])
+	assert.Equal(t, first, fmt.Sprint(slicePort()))
+
+	// the same host on another port, the healthy hosts stay the same
+	assert.Nil(t, backends.SetBackends(addresses[1:]))
+	assert.Nil(t, backends.CheckOnce(ctx))
+	_, second, _ := net.SplitHostPort(addresses[1])
+	assert.Equal(t, second, fmt.Sprint(slicePort()))
+}
+
+func TestExternalBackendsHTTP(t *testing.T) {
+	cluster := newSelectorlessServiceCluster()
+	ctx := context.Background()
+
+	var healthy atomic.Bool
+	healthy.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" || !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	backend := server.Listener.Addr().String()
+
+	backends, err := cluster.client.NewExternalBackends("default", "db", []string{backend}, ExternalBackendsOptions{
+		Check:           BackendCheck{Type: BackendCheckHTTP, Path: "/healthz", UnhealthyThreshold: 1},
+		LegacyEndpoints: true,
+	})
+	assert.Nil(t, err)
+
+	assert.Nil(t, backends.CheckOnce(ctx))
+	endpoints, err := cluster.clientset.CoreV1().Endpoints("default").Get(ctx, "db", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "127.0.0.1", endpoints.Subsets[0].Addresses[0].IP)
+
+	healthy.Store(false)
+	assert.Nil(t, backends.CheckOnce(ctx))
+	endpoints, err = cluster.clientset.CoreV1().Endpoints("default").Get(ctx, "db", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Empty(t, endpoints.Subsets)
+	assert.Contains(t, backends.Status()[0].LastError.Error(), "503")
+}
+
+func TestExternalBackendsRun(t *testing.T) {
+	cluster := newSelectorlessServiceCluster()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	backends, err := cluster.client.NewExternalBackends("default", "db", []string{server.Listener.Addr().String()}, ExternalBackendsOptions{
+		Interval: 10 * time.Millisecond,
+	})
+	assert.Nil(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	backends.Run(ctx)
+	assert.True(t, backends.Status()[0].Healthy)
+}
+
+func TestExternalBackendsInvalid(t *testing.T) {
+	client := newSelectorlessServiceCluster().client
+	for name, backends := range map[string][]string{
+		"no port":         {"10.0.0.1"},
+		"bad port":        {"10.0.0.1:http"},
+		"different ports": {"10.0.0.1:5432", "10.0.0.2:5433"},
+		"bad host":        {"not a host:5432"},
+	} {
+		_, err := client.NewExternalBackends("default", "db", backends, ExternalBackendsOptions{})
+		assert.NotNil(t, err, name)
+	}
+	_, err := client.NewExternalBackends("default", "db", []string{"db.example.com:5432"}, ExternalBackendsOptions{LegacyEndpoints: true})
+	assert.NotNil(t, err)
+	_, err = client.NewExternalBackends("default", "db", nil, ExternalBackendsOptions{Check: BackendCheck{Type: "icmp"}})
+	assert.NotNil(t, err)
+}
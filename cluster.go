@@ -0,0 +1,201 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const defaultClusterParallelism = 4
+
+// ClusterFunc is run once per cluster by ClusterSet.Do.
+type ClusterFunc func(ctx context.Context, cluster string, client *KubernetesClient) (interface{}, error)
+
+type ClusterResult struct {
+	Cluster string
+	Value   interface{} // what the ClusterFunc returned, e.g. *ApplyReport for Apply
+	Err     error
+}
+
+// ClusterResults are sorted by cluster name.
+type ClusterResults []ClusterResult
+
+func (r ClusterResults) Failed() []ClusterResult {
+	var failed []ClusterResult
+	for _, result := range r {
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// Err aggregates the errors of all clusters, prefixed with the cluster name.
+func (r ClusterResults) Err() error {
+	var errs []error
+	for _, result := range r.Failed() {
+		errs = append(errs, fmt.Errorf("cluster %s: %w", result.Cluster, result.Err))
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// ClusterSet holds named clients and runs calls on all of them concurrently,
+// at most parallelism clusters at a time.
+type ClusterSet struct {
+	mu          sync.RWMutex
+	clusters    map[string]*KubernetesClient
+	parallelism int
+}
+
+// NewClusterSet returns an empty set, a parallelism <= 0 uses the default of 4.
+func NewClusterSet(parallelism int) *ClusterSet {
+	if parallelism <= 0 {
+		parallelism = defaultClusterParallelism
+	}
+	return &ClusterSet{clusters: map[string]*KubernetesClient{}, parallelism: parallelism}
+}
+
+// NewClusterSetFromKubeconfig adds one cluster per context, named after the
+// context. path is loaded like in NewKubernetesClientFromKubeconfig, no
+// contexts means every context of the kubeconfig.
+func NewClusterSetFromKubeconfig(path string, contexts []string, parallelism int, opts ...ClientOption) (*ClusterSet, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if path != "" {
+		loadingRules.Precedence = filepath.SplitList(path)
+	}
+	config, err := loadingRules.Load()
+	if err != nil {
+		return nil, err
+	}
+	if len(contexts) == 0 {
+		for name := range config.Contexts {
+			contexts = append(contexts, name)
+		}
+	}
+
+	set := NewClusterSet(parallelism)
+	for _, name := range contexts {
+		if _, ok := config.Contexts[name]; !ok {
+			return nil, fmt.Errorf("context %q not found in kubeconfig", name)
+		}
+		restConfig, err := clientcmd.NewNonInteractiveClientConfig(*config, name, &clientcmd.ConfigOverrides{}, loadingRules).ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("context %s: %w", name, err)
+		}
+		client, err := NewKubernetesClientForConfig(restConfig, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("context %s: %w", name, err)
+		}
+		set.Add(name, client)
+	}
+	return set, nil
+}
+
+// Add registers client as name, replacing a client already registered under that name.
+func (s *ClusterSet) Add(name string, client *KubernetesClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clusters[name] = client
+}
+
+func (s *ClusterSet) Remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.clusters, name)
+}
+
+func (s *ClusterSet) Get(name string) (*KubernetesClient, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	client, ok := s.clusters[name]
+	return client, ok
+}
+
+func (s *ClusterSet) Names() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.clusters))
+	for name := range s.clusters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Do runs fn on every cluster and waits for all of them. A failing cluster
+// does not stop the others, clusters not started when ctx is done get ctx.Err().
+func (s *ClusterSet) Do(ctx context.Context, fn ClusterFunc) ClusterResults {
+	names := s.Names()
+	results := make(ClusterResults, len(names))
+	sem := make(chan struct{}, s.parallelism)
+	var wg sync.WaitGroup
+
+	for i, name := range names {
+		results[i].Cluster = name
+		client, ok := s.Get(name)
+		if !ok {
+			results[i].Err = fmt.Errorf("cluster %s was removed", name)
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			results[i].Err = ctx.Err()
+			continue
+		}
+		// both cases may have been ready, do not start work after cancellation
+		if err := ctx.Err(); err != nil {
+			<-sem
+			results[i].Err = err
+			continue
+		}
+		wg.Add(1)
+		go func(result *ClusterResult, client *KubernetesClient) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			result.Value, result.Err = fn(ctx, result.Cluster, client)
+		}(&results[i], client)
+	}
+	wg.Wait()
+	return results
+}
+
+// Apply runs ApplyDynamicUnstructured on every cluster, each Value is an *ApplyReport.
+func (s *ClusterSet) Apply(ctx context.Context, manifests YAML, opts ApplyOptions) ClusterResults {
+	return s.Do(ctx, func(ctx context.Context, cluster string, client *KubernetesClient) (interface{}, error) {
+		report, err := client.ApplyDynamicUnstructured(ctx, manifests, opts)
+		if err != nil {
+			return report, err
+		}
+		return report, report.Err()
+	})
+}
+
+func (s *ClusterSet) CreateDynamicUnstructured(ctx context.Context, yaml string) ClusterResults {
+	return s.Do(ctx, func(ctx context.Context, cluster string, client *KubernetesClient) (interface{}, error) {
+		return nil, client.CreateDynamicUnstructured(ctx, yaml)
+	})
+}
+
+func (s *ClusterSet) DeleteDynamicUnstructured(ctx context.Context, yaml string) ClusterResults {
+	return s.Do(ctx, func(ctx context.Context, cluster string, client *KubernetesClient) (interface{}, error) {
+		return nil, client.DeleteDynamicUnstructured(ctx, yaml)
+	})
+}
+
+// List lists gvk in namespace on every cluster, each Value is an *unstructured.UnstructuredList.
+func (s *ClusterSet) List(ctx context.Context, gvk schema.GroupVersionKind, namespace string, opts ...ListOptions) ClusterResults {
+	return s.Do(ctx, func(ctx context.Context, cluster string, client *KubernetesClient) (interface{}, error) {
+		list, err := client.ListByGVK(ctx, gvk, namespace, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return list, nil
+	})
+}
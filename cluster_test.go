@@ -0,0 +1,110 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestClusterSetApplyAndList(t *testing.T) {
+	set := NewClusterSet(0)
+	set.Add("prod", newFakeCluster().client)
+	set.Add("staging", newFakeCluster().client)
+	ctx := context.Background()
+
+	results := set.Apply(ctx, YAML(fakeDeploymentYAML), ApplyOptions{})
+	assert.Nil(t, results.Err())
+	assert.Equal(t, []string{"prod", "staging"}, []string{results[0].Cluster, results[1].Cluster})
+	assert.Len(t, results[0].Value.(*ApplyReport).Results, 1)
+
+	results = set.List(ctx, appsv1.SchemeGroupVersion.WithKind(DeploymentKind), "default")
+	assert.Nil(t, results.Err())
+	for _, result := range results {
+		assert.Len(t, result.Value.(*unstructured.UnstructuredList).Items, 1)
+	}
+
+	set.Remove("staging")
+	results = set.DeleteDynamicUnstructured(ctx, fakeDeploymentYAML)
+	assert.Len(t, results, 1)
+	assert.Nil(t, results.Err())
+}
+
+func TestClusterSetPerClusterErrors(t *testing.T) {
+	set := NewClusterSet(2)
+	set.Add("a", newFakeCluster().client)
+	set.Add("b", newFakeCluster().client)
+	ctx := context.Background()
+	assert.Nil(t, set.CreateDynamicUnstructured(ctx, fakeConfigMapYAML).Err())
+
+	client, _ := set.Get("a")
+	assert.Nil(t, client.DeleteDynamicUnstructured(ctx, fakeConfigMapYAML))
+
+	results := set.DeleteDynamicUnstructured(ctx, fakeConfigMapYAML)
+	assert.Len(t, results.Failed(), 1)
+	assert.Equal(t, "a", results.Failed()[0].Cluster)
+	assert.True(t, IsNotFound(results[0].Err))
+	assert.Nil(t, results[1].Err)
+	assert.Contains(t, results.Err().Error(), "cluster a: ")
+}
+
+func TestClusterSetParallelism(t *testing.T) {
+	set := NewClusterSet(2)
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		set.Add(name, &KubernetesClient{})
+	}
+
+	var running, peak int32
+	results := set.Do(context.Background(), func(ctx context.Context, cluster string, client *KubernetesClient) (interface{}, error) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return cluster, nil
+	})
+
+	assert.Nil(t, results.Err())
+	assert.Len(t, results, 5)
+	assert.Equal(t, "e", results[4].Value)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&peak))
+}
+
+func TestClusterSetCancelled(t *testing.T) {
+	set := NewClusterSet(1)
+	set.Add("a", &KubernetesClient{})
+	set.Add("b", &KubernetesClient{})
+	ctx, cancel := context.WithCancel(context.Background())
+
+	results := set.Do(ctx, func(ctx context.Context, cluster string, client *KubernetesClient) (interface{}, error) {
+		cancel()
+		return nil, nil
+	})
+	assert.Nil(t, results[0].Err)
+	assert.True(t, errors.Is(results[1].Err, context.Canceled))
+}
+
+func TestNewClusterSetFromKubeconfig(t *testing.T) {
+	a, b := writeTestKubeconfigs(t)
+
+	set, err := NewClusterSetFromKubeconfig(a+string(os.PathListSeparator)+b, nil, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b", "shared"}, set.Names())
+
+	set, err = NewClusterSetFromKubeconfig(a, []string{"shared"}, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"shared"}, set.Names())
+
+	_, err = NewClusterSetFromKubeconfig(a, []string{"b"}, 0)
+	assert.NotNil(t, err)
+}
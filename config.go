@@ -0,0 +1,95 @@
+package kubernetes
+
+import (
+	"path/filepath"
+	"time"
+
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// ClientOption tunes the rest.Config the clients are built from.
+type ClientOption func(*rest.Config)
+
+// WithQPS sets the client side rate limit, client-go defaults to 5.
+func WithQPS(qps float32) ClientOption {
+	return func(config *rest.Config) {
+		config.QPS = qps
+	}
+}
+
+// WithBurst sets the client side burst, client-go defaults to 10.
+func WithBurst(burst int) ClientOption {
+	return func(config *rest.Config) {
+		config.Burst = burst
+	}
+}
+
+// WithTimeout limits every request, watches included. 0 means no timeout.
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(config *rest.Config) {
+		config.Timeout = timeout
+	}
+}
+
+func WithUserAgent(userAgent string) ClientOption {
+	return func(config *rest.Config) {
+		config.UserAgent = userAgent
+	}
+}
+
+// NewKubernetesClientForConfig builds a client on a copy of config, opts are applied to the copy.
+func NewKubernetesClientForConfig(config *rest.Config, opts ...ClientOption) (*KubernetesClient, error) {
+	config = rest.CopyConfig(config)
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	dynamicinterface, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	discoveryclient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return NewKubernetesClientFromInterfaces(clientset, dynamicinterface, discoveryclient), nil
+}
+
+// NewInClusterKubernetesClient uses the service account of the pod it runs in.
+// Outside a cluster it returns rest.ErrNotInCluster.
+func NewInClusterKubernetesClient(opts ...ClientOption) (*KubernetesClient, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	return NewKubernetesClientForConfig(config, opts...)
+}
+
+// NewKubernetesClientFromKubeconfig loads kubeconfig files the way kubectl
+// does. path is a single file or a list like $KUBECONFIG, the files are merged
+// and the first one to set a value wins. An empty path uses $KUBECONFIG or
+// ~/.kube/config, an empty context the current context.
+func NewKubernetesClientFromKubeconfig(path string, context string, opts ...ClientOption) (*KubernetesClient, error) {
+	config, err := loadKubeconfig(path, context)
+	if err != nil {
+		return nil, err
+	}
+	return NewKubernetesClientForConfig(config, opts...)
+}
+
+func loadKubeconfig(path string, context string) (*rest.Config, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if path != "" {
+		loadingRules.Precedence = filepath.SplitList(path)
+	}
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: context}
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides).ClientConfig()
+}
@@ -0,0 +1,127 @@
+package kubernetes
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/rest"
+)
+
+const testKubeconfigA = `
+apiVersion: v1
+kind: Config
+current-context: a
+clusters:
+- name: a
+  cluster:
+    server: https://a.example.com
+- name: shared
+  cluster:
+    server: https://shared-from-a.example.com
+users:
+- name: a
+  user:
+    token: token-a
+contexts:
+- name: a
+  context:
+    cluster: a
+    user: a
+- name: shared
+  context:
+    cluster: shared
+    user: a
+`
+
+const testKubeconfigB = `
+apiVersion: v1
+kind: Config
+current-context: b
+clusters:
+- name: b
+  cluster:
+    server: https://b.example.com
+- name: shared
+  cluster:
+    server: https://shared-from-b.example.com
+users:
+- name: b
+  user:
+    token: token-b
+contexts:
+- name: b
+  context:
+    cluster: b
+    user: b
+`
+
+func writeTestKubeconfigs(t *testing.T) (string, string) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	assert.Nil(t, os.WriteFile(a, []byte(testKubeconfigA), 0600))
+	assert.Nil(t, os.WriteFile(b, []byte(testKubeconfigB), 0600))
+	return a, b
+}
+
+func TestLoadKubeconfigContext(t *testing.T) {
+	a, _ := writeTestKubeconfigs(t)
+
+	config, err := loadKubeconfig(a, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://a.example.com", config.Host)
+	assert.Equal(t, "token-a", config.BearerToken)
+
+	config, err = loadKubeconfig(a, "shared")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://shared-from-a.example.com", config.Host)
+
+	_, err = loadKubeconfig(a, "missing")
+	assert.NotNil(t, err)
+}
+
+func TestLoadKubeconfigMerge(t *testing.T) {
+	a, b := writeTestKubeconfigs(t)
+	paths := b + string(os.PathListSeparator) + a
+
+	// the first file wins for current-context and clusters defined twice
+	config, err := loadKubeconfig(paths, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://b.example.com", config.Host)
+
+	config, err = loadKubeconfig(paths, "shared")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://shared-from-b.example.com", config.Host)
+
+	t.Setenv("KUBECONFIG", paths)
+	config, err = loadKubeconfig("", "a")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://a.example.com", config.Host)
+}
+
+func TestNewKubernetesClientForConfigOptions(t *testing.T) {
+	config := &rest.Config{Host: "https://a.example.com"}
+	var applied *rest.Config
+	client, err := NewKubernetesClientForConfig(config,
+		WithQPS(50), WithBurst(100), WithTimeout(time.Minute), WithUserAgent("cg-controller"),
+		func(config *rest.Config) { applied = config })
+
+	assert.Nil(t, err)
+	assert.NotNil(t, client)
+	assert.Equal(t, float32(50), applied.QPS)
+	assert.Equal(t, 100, applied.Burst)
+	assert.Equal(t, time.Minute, applied.Timeout)
+	assert.Equal(t, "cg-controller", applied.UserAgent)
+	// the caller's config is left alone
+	assert.Equal(t, float32(0), config.QPS)
+}
+
+func TestNewInClusterKubernetesClientOutsideCluster(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	t.Setenv("KUBERNETES_SERVICE_PORT", "")
+
+	_, err := NewInClusterKubernetesClient()
+	assert.Equal(t, rest.ErrNotInCluster, err)
+}
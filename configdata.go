@@ -0,0 +1,362 @@
+package kubernetes
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ConfigDataSpec is the content of a ConfigMap or Secret, built like
+// kubectl create configmap|secret with --from-literal, --from-file and
+// --from-env-file. Keys must be unique across all sources.
+type ConfigDataSpec struct {
+	Name        string
+	Labels      map[string]string
+	Annotations map[string]string
+	Data        map[string]string
+	BinaryData  map[string][]byte // values that are not UTF-8
+	Immutable   bool
+
+	// HashSuffix appends a hash of the content to the name, e.g.
+	// settings-3f2a9c81b0, so a changed config is a new object and the
+	// pods referring to it roll.
+	HashSuffix bool
+}
+
+func NewConfigDataSpec(name string) *ConfigDataSpec {
+	return &ConfigDataSpec{Name: name}
+}
+
+func (s *ConfigDataSpec) WithLabel(key string, value string) *ConfigDataSpec {
+	s.Labels = setKey(s.Labels, key, value)
+	return s
+}
+
+func (s *ConfigDataSpec) WithAnnotation(key string, value string) *ConfigDataSpec {
+	s.Annotations = setKey(s.Annotations, key, value)
+	return s
+}
+
+// WithLiteral sets key to value, a key already set is overwritten.
+func (s *ConfigDataSpec) WithLiteral(key string, value string) *ConfigDataSpec {
+	delete(s.BinaryData, key)
+	s.Data = setKey(s.Data, key, value)
+	return s
+}
+
+// WithBinary sets key to data, kept in binaryData of a ConfigMap.
+func (s *ConfigDataSpec) WithBinary(key string, data []byte) *ConfigDataSpec {
+	delete(s.Data, key)
+	if s.BinaryData == nil {
+		s.BinaryData = map[string][]byte{}
+	}
+	s.BinaryData[key] = data
+	return s
+}
+
+// WithImmutable makes the object read-only, the API server stops watching it.
+func (s *ConfigDataSpec) WithImmutable() *ConfigDataSpec {
+	s.Immutable = true
+	return s
+}
+
+func (s *ConfigDataSpec) WithHashSuffix() *ConfigDataSpec {
+	s.HashSuffix = true
+	return s
+}
+
+// AddFile adds the content of path as key, the file name when key is "".
+func (s *ConfigDataSpec) AddFile(key string, path string) error {
+	if key == "" {
+		key = filepath.Base(path)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return s.add(key, content, path)
+}
+
+// AddDir adds every regular file directly in dir, keyed by file name.
+// Subdirectories are skipped like kubectl does.
+func (s *ConfigDataSpec) AddDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if err := s.AddFile(entry.Name(), filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddEnvFile adds the KEY=VALUE lines of path. Blank lines and lines
+// starting with # are skipped, values are taken as is without unquoting and
+// a KEY without "=" takes its value from the environment.
+func (s *ConfigDataSpec) AddEnvFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimLeft(scanner.Text(), " \t")
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(text, "=")
+		if !found {
+			var ok bool
+			if value, ok = os.LookupEnv(key); !ok {
+				continue
+			}
+		}
+		if errs := validation.IsEnvVarName(key); len(errs) > 0 {
+			return fmt.Errorf("%s:%d: invalid key %q: %s", path, line, key, strings.Join(errs, ", "))
+		}
+		if err := s.add(key, []byte(value), path); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func (s *ConfigDataSpec) add(key string, content []byte, source string) error {
+	if errs := validation.IsConfigMapKey(key); len(errs) > 0 {
+		return fmt.Errorf("%s: invalid key %q: %s", source, key, strings.Join(errs, ", "))
+	}
+	_, inData := s.Data[key]
+	_, inBinaryData := s.BinaryData[key]
+	if inData || inBinaryData {
+		return fmt.Errorf("%s: key %q is already set", source, key)
+	}
+	if utf8.Valid(content) {
+		s.WithLiteral(key, string(content))
+	} else {
+		s.WithBinary(key, content)
+	}
+	return nil
+}
+
+// Hash is a hash of the data, binary data and immutability, the same
+// content always gives the same hash.
+func (s *ConfigDataSpec) Hash() string {
+	sum, _ := contentHash(struct {
+		Data       map[string]string `json:"data"`
+		BinaryData map[string][]byte `json:"binaryData"`
+		Immutable  bool              `json:"immutable"`
+	}{s.Data, s.BinaryData, s.Immutable})
+	return sum[:10]
+}
+
+// contentHash is the hex sha256 of v encoded as JSON. The encoding sorts map
+// keys, so the same content always gives the same hash.
+func contentHash(v interface{}) (string, error) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ObjectName is the name the object gets, with the hash when HashSuffix is set.
+func (s *ConfigDataSpec) ObjectName() string {
+	if s.HashSuffix {
+		return s.Name + "-" + s.Hash()
+	}
+	return s.Name
+}
+
+func (s *ConfigDataSpec) objectMeta(namespace string) (metav1.ObjectMeta, error) {
+	if s.Name == "" {
+		return metav1.ObjectMeta{}, errors.New("name is required")
+	}
+	for key := range s.Data {
+		if errs := validation.IsConfigMapKey(key); len(errs) > 0 {
+			return metav1.ObjectMeta{}, fmt.Errorf("invalid key %q: %s", key, strings.Join(errs, ", "))
+		}
+	}
+	for key := range s.BinaryData {
+		if errs := validation.IsConfigMapKey(key); len(errs) > 0 {
+			return metav1.ObjectMeta{}, fmt.Errorf("invalid key %q: %s", key, strings.Join(errs, ", "))
+		}
+	}
+	return metav1.ObjectMeta{
+		Name:        s.ObjectName(),
+		Namespace:   namespace,
+		Labels:      s.Labels,
+		Annotations: s.Annotations,
+	}, nil
+}
+
+func (s *ConfigDataSpec) immutable() *bool {
+	if !s.Immutable {
+		return nil
+	}
+	immutable := true
+	return &immutable
+}
+
+func (s *ConfigDataSpec) ConfigMap(namespace string) (*v1.ConfigMap, error) {
+	meta, err := s.objectMeta(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return &v1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: ConfigMapKind},
+		ObjectMeta: meta,
+		Data:       s.Data,
+		BinaryData: s.BinaryData,
+		Immutable:  s.immutable(),
+	}, nil
+}
+
+// Secret returns a Secret of secretType, Opaque when "". Data and binary
+// data both end up in the data of the secret.
+func (s *ConfigDataSpec) Secret(namespace string, secretType v1.SecretType) (*v1.Secret, error) {
+	meta, err := s.objectMeta(namespace)
+	if err != nil {
+		return nil, err
+	}
+	if secretType == "" {
+		secretType = v1.SecretTypeOpaque
+	}
+	data := map[string][]byte{}
+	for key, value := range s.Data {
+		data[key] = []byte(value)
+	}
+	for key, value := range s.BinaryData {
+		data[key] = value
+	}
+	return &v1.Secret{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: SecretKind},
+		ObjectMeta: meta,
+		Type:       secretType,
+		Data:       data,
+		Immutable:  s.immutable(),
+	}, nil
+}
+
+func (c *KubernetesClient) CreateConfigMapFromSpec(ctx context.Context, namespace string, spec *ConfigDataSpec) (*v1.ConfigMap, error) {
+	gvk := v1.SchemeGroupVersion.WithKind(ConfigMapKind)
+	configmap, err := spec.ConfigMap(namespace)
+	if err != nil {
+		return nil, objectError("create", gvk, namespace, spec.Name, err)
+	}
+	result, err := c.clientset.CoreV1().ConfigMaps(namespace).Create(ctx, configmap, metav1.CreateOptions{})
+	if err != nil {
+		return nil, objectError("create", gvk, namespace, configmap.Name, err)
+	}
+	fmt.Printf("Created ConfigMap %s\n", result.Name)
+	return result, nil
+}
+
+// UpdateConfigMapFromSpec replaces the content of an existing ConfigMap. An
+// immutable ConfigMap cannot change and stays immutable, with HashSuffix
+// create the new one instead.
+// Labels and annotations are merged in, those set by others are kept, e.g.
+// the release label.
+func (c *KubernetesClient) UpdateConfigMapFromSpec(ctx context.Context, namespace string, spec *ConfigDataSpec) (*v1.ConfigMap, error) {
+	gvk := v1.SchemeGroupVersion.WithKind(ConfigMapKind)
+	desired, err := spec.ConfigMap(namespace)
+	if err != nil {
+		return nil, objectError("update", gvk, namespace, spec.Name, err)
+	}
+	configmaps := c.clientset.CoreV1().ConfigMaps(namespace)
+	configmap, err := configmaps.Get(ctx, desired.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, objectError("update", gvk, namespace, desired.Name, err)
+	}
+	if isImmutable(configmap.Immutable) && !(reflect.DeepEqual(configmap.Data, desired.Data) && reflect.DeepEqual(configmap.BinaryData, desired.BinaryData)) {
+		return nil, objectError("update", gvk, namespace, desired.Name, errors.New("configmap is immutable, create a new one"))
+	}
+	configmap.Labels = mergeKeys(configmap.Labels, desired.Labels)
+	configmap.Annotations = mergeKeys(configmap.Annotations, desired.Annotations)
+	configmap.Data = desired.Data
+	configmap.BinaryData = desired.BinaryData
+	if !isImmutable(configmap.Immutable) {
+		configmap.Immutable = desired.Immutable
+	}
+	result, err := configmaps.Update(ctx, configmap, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, objectError("update", gvk, namespace, desired.Name, err)
+	}
+	fmt.Printf("Updated ConfigMap %s\n", result.Name)
+	return result, nil
+}
+
+func (c *KubernetesClient) CreateSecretFromSpec(ctx context.Context, namespace string, secretType v1.SecretType, spec *ConfigDataSpec) (*v1.Secret, error) {
+	gvk := v1.SchemeGroupVersion.WithKind(SecretKind)
+	secret, err := spec.Secret(namespace, secretType)
+	if err != nil {
+		return nil, objectError("create", gvk, namespace, spec.Name, err)
+	}
+	result, err := c.clientset.CoreV1().Secrets(namespace).Create(ctx, secret, metav1.CreateOptions{})
+	if err != nil {
+		return nil, objectError("create", gvk, namespace, secret.Name, err)
+	}
+	fmt.Printf("Created Secret %s\n", result.Name)
+	return result, nil
+}
+
+// UpdateSecretFromSpec replaces the content of an existing Secret, its type
+// cannot change. Labels and annotations are merged like UpdateConfigMapFromSpec does.
+func (c *KubernetesClient) UpdateSecretFromSpec(ctx context.Context, namespace string, spec *ConfigDataSpec) (*v1.Secret, error) {
+	gvk := v1.SchemeGroupVersion.WithKind(SecretKind)
+	secrets := c.clientset.CoreV1().Secrets(namespace)
+	secret, err := secrets.Get(ctx, spec.ObjectName(), metav1.GetOptions{})
+	if err != nil {
+		return nil, objectError("update", gvk, namespace, spec.ObjectName(), err)
+	}
+	desired, err := spec.Secret(namespace, secret.Type)
+	if err != nil {
+		return nil, objectError("update", gvk, namespace, spec.Name, err)
+	}
+	if isImmutable(secret.Immutable) && !reflect.DeepEqual(secret.Data, desired.Data) {
+		return nil, objectError("update", gvk, namespace, desired.Name, errors.New("secret is immutable, create a new one"))
+	}
+	secret.Labels = mergeKeys(secret.Labels, desired.Labels)
+	secret.Annotations = mergeKeys(secret.Annotations, desired.Annotations)
+	secret.Data = desired.Data
+	secret.StringData = nil
+	if !isImmutable(secret.Immutable) {
+		secret.Immutable = desired.Immutable
+	}
+	result, err := secrets.Update(ctx, secret, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, objectError("update", gvk, namespace, desired.Name, err)
+	}
+	fmt.Printf("Updated Secret %s\n", result.Name)
+	return result, nil
+}
+
+func (c *KubernetesClient) DeleteSecret(ctx context.Context, namespace string, name string) error {
+	err := c.clientset.CoreV1().Secrets(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	return objectError("delete", v1.SchemeGroupVersion.WithKind(SecretKind), namespace, name, err)
+}
+
+func isImmutable(immutable *bool) bool {
+	return immutable != nil && *immutable
+}
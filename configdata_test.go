@@ -0,0 +1,141 @@
+package kubernetes
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func writeTestFile(t *testing.T, path string, content string) string {
+	assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	assert.Nil(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestConfigDataSpecSources(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "conf", "nginx.conf"), "worker_processes 1;\n")
+	writeTestFile(t, filepath.Join(dir, "conf", "logo.png"), "\x89PNG\r\n\x1a\n\xff")
+	writeTestFile(t, filepath.Join(dir, "conf", "nested", "skipped.txt"), "skipped")
+	t.Setenv("FROM_ENVIRONMENT", "yes")
+	env := writeTestFile(t, filepath.Join(dir, "app.env"), "\xef\xbb\xbf# comment\n\nLOG_LEVEL=debug\n  QUOTED=\"kept as is\"\nFROM_ENVIRONMENT\nNOT_SET_ANYWHERE\n")
+
+	spec := NewConfigDataSpec("app").WithLiteral("mode", "production")
+	assert.Nil(t, spec.AddDir(filepath.Join(dir, "conf")))
+	assert.Nil(t, spec.AddFile("settings", env))
+	assert.Nil(t, spec.AddEnvFile(env))
+
+	assert.Equal(t, map[string]string{
+		"mode":             "production",
+		"nginx.conf":       "worker_processes 1;\n",
+		"settings":         "\xef\xbb\xbf# comment\n\nLOG_LEVEL=debug\n  QUOTED=\"kept as is\"\nFROM_ENVIRONMENT\nNOT_SET_ANYWHERE\n",
+		"LOG_LEVEL":        "debug",
+		"QUOTED":           "\"kept as is\"",
+		"FROM_ENVIRONMENT": "yes",
+	}, spec.Data)
+	assert.Equal(t, map[string][]byte{"logo.png": []byte("\x89PNG\r\n\x1a\n\xff")}, spec.BinaryData)
+
+	// keys are unique across sources
+	assert.NotNil(t, spec.AddFile("mode", env))
+	assert.NotNil(t, spec.AddFile("bad/key", env))
+	assert.NotNil(t, spec.AddFile("", filepath.Join(dir, "missing")))
+	assert.NotNil(t, NewConfigDataSpec("app").AddEnvFile(writeTestFile(t, filepath.Join(dir, "bad.env"), "1BAD=x\n")))
+}
+
+func TestConfigDataSpecHash(t *testing.T) {
+	a := NewConfigDataSpec("settings").WithLiteral("a", "1").WithLiteral("b", "2").WithHashSuffix()
+	b := NewConfigDataSpec("settings").WithLiteral("b", "2").WithLiteral("a", "1").WithHashSuffix()
+	assert.Equal(t, a.Hash(), b.Hash())
+	assert.Equal(t, "settings-"+a.Hash(), a.ObjectName())
+	assert.Len(t, a.Hash(), 10)
+
+	b.WithLiteral("b", "3")
+	assert.NotEqual(t, a.Hash(), b.Hash())
+	assert.Equal(t, "settings", NewConfigDataSpec("settings").ObjectName())
+}
+
+func TestConfigDataSpecObjects(t *testing.T) {
+	spec := NewConfigDataSpec("tls").WithLiteral("tls.crt", "cert").WithBinary("tls.key", []byte{0xff}).WithImmutable()
+	configmap, err := spec.ConfigMap("default")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"tls.crt": "cert"}, configmap.Data)
+	assert.Equal(t, map[string][]byte{"tls.key": {0xff}}, configmap.BinaryData)
+	assert.True(t, *configmap.Immutable)
+
+	secret, err := spec.Secret("default", v1.SecretTypeTLS)
+	assert.Nil(t, err)
+	assert.Equal(t, v1.SecretTypeTLS, secret.Type)
+	assert.Equal(t, map[string][]byte{"tls.crt": []byte("cert"), "tls.key": {0xff}}, secret.Data)
+
+	secret, err = NewConfigDataSpec("plain").Secret("default", "")
+	assert.Nil(t, err)
+	assert.Equal(t, v1.SecretTypeOpaque, secret.Type)
+
+	_, err = NewConfigDataSpec("bad").WithLiteral("no spaces", "x").ConfigMap("default")
+	assert.NotNil(t, err)
+	_, err = NewConfigDataSpec("").Secret("default", "")
+	assert.NotNil(t, err)
+}
+
+func TestFakeConfigMapsAndSecrets(t *testing.T) {
+	cluster := newFakeCluster()
+	client := cluster.client
+	ctx := context.Background()
+
+	spec := NewConfigDataSpec("settings").WithLiteral("LOG_LEVEL", "info").WithLabel("team", "a")
+	configmap, err := client.CreateConfigMapFromSpec(ctx, "default", spec)
+	assert.Nil(t, err)
+	configmap.Labels[ReleaseLabel] = "web"
+	_, err = cluster.clientset.CoreV1().ConfigMaps("default").Update(ctx, configmap, metav1.UpdateOptions{})
+	assert.Nil(t, err)
+	spec.WithLiteral("LOG_LEVEL", "debug").WithBinary("blob", []byte{0xff}).WithLabel("team", "b")
+	configmap, err = client.UpdateConfigMapFromSpec(ctx, "default", spec)
+	assert.Nil(t, err)
+	assert.Equal(t, "debug", configmap.Data["LOG_LEVEL"])
+	assert.Equal(t, []byte{0xff}, configmap.BinaryData["blob"])
+	assert.Equal(t, map[string]string{"team": "b", ReleaseLabel: "web"}, configmap.Labels)
+
+	// an immutable ConfigMap keeps its content, with a hash suffix a change is a new object
+	frozen := NewConfigDataSpec("frozen").WithLiteral("a", "1").WithImmutable().WithHashSuffix()
+	first, err := client.CreateConfigMapFromSpec(ctx, "default", frozen)
+	assert.Nil(t, err)
+	frozen.HashSuffix = false
+	frozen.Name = first.Name
+	frozen.Immutable = false
+	// the same content without the flag keeps the ConfigMap immutable, the API server rejects unsetting it
+	configmap, err = client.UpdateConfigMapFromSpec(ctx, "default", frozen.WithLabel("team", "a"))
+	assert.Nil(t, err)
+	assert.True(t, isImmutable(configmap.Immutable))
+	frozen.WithLiteral("a", "2")
+	_, err = client.UpdateConfigMapFromSpec(ctx, "default", frozen)
+	assert.NotNil(t, err)
+
+	secretSpec := NewConfigDataSpec("db").WithLiteral("password", "s3cret")
+	_, err = client.CreateSecretFromSpec(ctx, "default", v1.SecretTypeBasicAuth, secretSpec.WithLiteral("username", "app"))
+	assert.Nil(t, err)
+	secret, err := client.UpdateSecretFromSpec(ctx, "default", secretSpec.WithLiteral("password", "n3w"))
+	assert.Nil(t, err)
+	assert.Equal(t, v1.SecretTypeBasicAuth, secret.Type)
+	assert.Equal(t, []byte("n3w"), secret.Data["password"])
+
+	lockedSpec := NewConfigDataSpec("locked").WithLiteral("token", "t").WithImmutable()
+	_, err = client.CreateSecretFromSpec(ctx, "default", "", lockedSpec)
+	assert.Nil(t, err)
+	lockedSpec.Immutable = false
+	secret, err = client.UpdateSecretFromSpec(ctx, "default", lockedSpec)
+	assert.Nil(t, err)
+	assert.True(t, isImmutable(secret.Immutable))
+
+	assert.True(t, IsNotFound(func() error {
+		_, err := client.UpdateSecretFromSpec(ctx, "default", NewConfigDataSpec("missing"))
+		return err
+	}()))
+	assert.Nil(t, client.DeleteSecret(ctx, "default", "db"))
+	_, err = cluster.clientset.CoreV1().Secrets("default").Get(ctx, "db", metav1.GetOptions{})
+	assert.True(t, IsNotFound(err))
+}
@@ -0,0 +1,182 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// DeploymentSpec describes a Deployment for CreateDeployFromSpec. Labels go on
+// the Deployment and its pods, Selector defaults to Labels.
+type DeploymentSpec struct {
+	Name               string
+	Replicas           int32
+	Labels             map[string]string
+	Selector           map[string]string
+	Annotations        map[string]string
+	PodAnnotations     map[string]string
+	Containers         []v1.Container
+	InitContainers     []v1.Container
+	Volumes            []v1.Volume
+	NodeSelector       map[string]string
+	Tolerations        []v1.Toleration
+	ServiceAccountName string
+}
+
+func NewDeploymentSpec(name string, replicas int32) *DeploymentSpec {
+	return &DeploymentSpec{Name: name, Replicas: replicas}
+}
+
+func (s *DeploymentSpec) WithLabel(key string, value string) *DeploymentSpec {
+	s.Labels = setKey(s.Labels, key, value)
+	return s
+}
+
+func (s *DeploymentSpec) WithAnnotation(key string, value string) *DeploymentSpec {
+	s.Annotations = setKey(s.Annotations, key, value)
+	return s
+}
+
+func (s *DeploymentSpec) WithPodAnnotation(key string, value string) *DeploymentSpec {
+	s.PodAnnotations = setKey(s.PodAnnotations, key, value)
+	return s
+}
+
+func (s *DeploymentSpec) WithContainer(container v1.Container) *DeploymentSpec {
+	s.Containers = append(s.Containers, container)
+	return s
+}
+
+func (s *DeploymentSpec) WithInitContainer(container v1.Container) *DeploymentSpec {
+	s.InitContainers = append(s.InitContainers, container)
+	return s
+}
+
+func (s *DeploymentSpec) WithVolume(volume v1.Volume) *DeploymentSpec {
+	s.Volumes = append(s.Volumes, volume)
+	return s
+}
+
+func (s *DeploymentSpec) WithNodeSelector(key string, value string) *DeploymentSpec {
+	s.NodeSelector = setKey(s.NodeSelector, key, value)
+	return s
+}
+
+func (s *DeploymentSpec) WithToleration(toleration v1.Toleration) *DeploymentSpec {
+	s.Tolerations = append(s.Tolerations, toleration)
+	return s
+}
+
+// Deployment returns the typed Deployment described by the spec.
+func (s *DeploymentSpec) Deployment(namespace string) (*appsv1.Deployment, error) {
+	if s.Name == "" {
+		return nil, errors.New("deployment name is required")
+	}
+	if len(s.Containers) == 0 {
+		return nil, fmt.Errorf("deployment %s needs at least one container", s.Name)
+	}
+	selector := s.Selector
+	if len(selector) == 0 {
+		selector = s.Labels
+	}
+	if len(selector) == 0 {
+		return nil, fmt.Errorf("deployment %s needs labels or a selector", s.Name)
+	}
+
+	podLabels := map[string]string{}
+	for k, v := range s.Labels {
+		podLabels[k] = v
+	}
+	for k, v := range selector {
+		podLabels[k] = v
+	}
+	replicas := s.Replicas
+
+	return &appsv1.Deployment{
+		TypeMeta: metav1.TypeMeta{APIVersion: "apps/v1", Kind: DeploymentKind},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        s.Name,
+			Namespace:   namespace,
+			Labels:      s.Labels,
+			Annotations: s.Annotations,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: selector},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:      podLabels,
+					Annotations: s.PodAnnotations,
+				},
+				Spec: v1.PodSpec{
+					Containers:         s.Containers,
+					InitContainers:     s.InitContainers,
+					Volumes:            s.Volumes,
+					NodeSelector:       s.NodeSelector,
+					Tolerations:        s.Tolerations,
+					ServiceAccountName: s.ServiceAccountName,
+				},
+			},
+		},
+	}, nil
+}
+
+// Unstructured returns the Deployment as sent through the dynamic client.
+func (s *DeploymentSpec) Unstructured(namespace string) (*unstructured.Unstructured, error) {
+	deployment, err := s.Deployment(namespace)
+	if err != nil {
+		return nil, err
+	}
+	object, err := runtime.DefaultUnstructuredConverter.ToUnstructured(deployment)
+	if err != nil {
+		return nil, err
+	}
+	delete(object, "status")
+	return &unstructured.Unstructured{Object: object}, nil
+}
+
+func (c *KubernetesClient) CreateDeployFromSpec(ctx context.Context, namespace string, spec *DeploymentSpec) (*unstructured.Unstructured, error) {
+	deployment, err := spec.Unstructured(namespace)
+	if err != nil {
+		return nil, objectError("create", appsv1.SchemeGroupVersion.WithKind(DeploymentKind), namespace, spec.Name, err)
+	}
+
+	if err := c.stampConfigChecksum(ctx, deployment, nil); err != nil {
+		return nil, objectError("create", appsv1.SchemeGroupVersion.WithKind(DeploymentKind), namespace, spec.Name, err)
+	}
+
+	deploymentRes := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+
+	// Create Deployment
+	fmt.Println("Creating deployment...")
+	result, err := c.dynamicinterface.Resource(deploymentRes).Namespace(namespace).Create(ctx, deployment, metav1.CreateOptions{})
+	if err != nil {
+		return nil, objectError("create", appsv1.SchemeGroupVersion.WithKind(DeploymentKind), namespace, spec.Name, err)
+	}
+	fmt.Printf("Created deployment %q.\n", result.GetName())
+
+	return result, nil
+}
+
+func setKey(m map[string]string, key string, value string) map[string]string {
+	if m == nil {
+		m = map[string]string{}
+	}
+	m[key] = value
+	return m
+}
+
+// mergeKeys sets the keys of from in m, keys only in m are kept.
+func mergeKeys(m map[string]string, from map[string]string) map[string]string {
+	for key, value := range from {
+		m = setKey(m, key, value)
+	}
+	return m
+}
@@ -0,0 +1,59 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestDeploymentSpecUnstructured(t *testing.T) {
+	spec := NewDeploymentSpec("web", 2).
+		WithLabel("app", "web").
+		WithLabel("tier", "front").
+		WithPodAnnotation("prometheus.io/scrape", "true").
+		WithInitContainer(v1.Container{Name: "migrate", Image: "web:1.0", Args: []string{"migrate"}}).
+		WithContainer(v1.Container{
+			Name:    "web",
+			Image:   "web:1.0",
+			Env:     []v1.EnvVar{{Name: "MODE", Value: "prod"}},
+			EnvFrom: []v1.EnvFromSource{{ConfigMapRef: &v1.ConfigMapEnvSource{LocalObjectReference: v1.LocalObjectReference{Name: "web"}}}},
+			Resources: v1.ResourceRequirements{
+				Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse("256Mi")},
+			},
+		}).
+		WithNodeSelector("pool", "web").
+		WithToleration(v1.Toleration{Key: "dedicated", Operator: v1.TolerationOpEqual, Value: "web", Effect: v1.TaintEffectNoSchedule})
+	spec.Selector = map[string]string{"app": "web"}
+
+	obj, err := spec.Unstructured("default")
+	assert.Nil(t, err)
+
+	assert.Equal(t, "apps/v1", obj.GetAPIVersion())
+	assert.Equal(t, DeploymentKind, obj.GetKind())
+	assert.Equal(t, "default", obj.GetNamespace())
+	replicas, _, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+	assert.Equal(t, int64(2), replicas)
+	selector, _, _ := unstructured.NestedStringMap(obj.Object, "spec", "selector", "matchLabels")
+	assert.Equal(t, map[string]string{"app": "web"}, selector)
+	podLabels, _, _ := unstructured.NestedStringMap(obj.Object, "spec", "template", "metadata", "labels")
+	assert.Equal(t, map[string]string{"app": "web", "tier": "front"}, podLabels)
+	containers, _, _ := unstructured.NestedSlice(obj.Object, "spec", "template", "spec", "containers")
+	assert.Len(t, containers, 1)
+	memory, _, _ := unstructured.NestedString(containers[0].(map[string]interface{}), "resources", "limits", "memory")
+	assert.Equal(t, "256Mi", memory)
+	_, hasStatus := obj.Object["status"]
+	assert.False(t, hasStatus)
+	// must survive the deep copies done by the dynamic client
+	assert.NotPanics(t, func() { obj.DeepCopy() })
+}
+
+func TestDeploymentSpecValidation(t *testing.T) {
+	_, err := NewDeploymentSpec("web", 1).WithLabel("app", "web").Unstructured("default")
+	assert.NotNil(t, err)
+
+	_, err = NewDeploymentSpec("web", 1).WithContainer(v1.Container{Name: "web", Image: "web"}).Unstructured("default")
+	assert.NotNil(t, err)
+}
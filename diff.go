@@ -0,0 +1,138 @@
+package kubernetes
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+type ChangeType string
+
+const (
+	FieldAdded   ChangeType = "added"
+	FieldChanged ChangeType = "changed"
+	FieldRemoved ChangeType = "removed"
+)
+
+// FieldChange is a single difference between a live object and its desired state.
+// Path uses dots for map keys and [i] for list indexes, e.g.
+// spec.template.spec.containers[0].image.
+type FieldChange struct {
+	Type ChangeType
+	Path string
+	Old  interface{}
+	New  interface{}
+}
+
+func (f FieldChange) String() string {
+	switch f.Type {
+	case FieldAdded:
+		return fmt.Sprintf("+ %s: %v", f.Path, f.New)
+	case FieldRemoved:
+		return fmt.Sprintf("- %s: %v", f.Path, f.Old)
+	default:
+		return fmt.Sprintf("~ %s: %v -> %v", f.Path, f.Old, f.New)
+	}
+}
+
+// fields the server owns, they change on every write and only add noise
+var ignoredDiffPaths = map[string]struct{}{
+	"status":                     {},
+	"metadata.managedFields":     {},
+	"metadata.resourceVersion":   {},
+	"metadata.generation":        {},
+	"metadata.uid":               {},
+	"metadata.creationTimestamp": {},
+	"metadata.selfLink":          {},
+}
+
+// DiffUnstructured returns the field-level changes that turn live into desired.
+// A nil live object means the object does not exist yet.
+func DiffUnstructured(live, desired *unstructured.Unstructured) []FieldChange {
+	var from, to map[string]interface{}
+	if live != nil {
+		from = live.Object
+	}
+	if desired != nil {
+		to = desired.Object
+	}
+	var changes []FieldChange
+	diffMap("", from, to, &changes)
+	return changes
+}
+
+func diffValue(path string, from, to interface{}, changes *[]FieldChange) {
+	fromMap, fromIsMap := from.(map[string]interface{})
+	toMap, toIsMap := to.(map[string]interface{})
+	if fromIsMap && toIsMap {
+		diffMap(path, fromMap, toMap, changes)
+		return
+	}
+
+	fromSlice, fromIsSlice := from.([]interface{})
+	toSlice, toIsSlice := to.([]interface{})
+	if fromIsSlice && toIsSlice {
+		for i := 0; i < len(fromSlice) || i < len(toSlice); i++ {
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(fromSlice):
+				*changes = append(*changes, FieldChange{Type: FieldAdded, Path: itemPath, New: toSlice[i]})
+			case i >= len(toSlice):
+				*changes = append(*changes, FieldChange{Type: FieldRemoved, Path: itemPath, Old: fromSlice[i]})
+			default:
+				diffValue(itemPath, fromSlice[i], toSlice[i], changes)
+			}
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(from, to) {
+		*changes = append(*changes, FieldChange{Type: FieldChanged, Path: path, Old: from, New: to})
+	}
+}
+
+func diffMap(path string, from, to map[string]interface{}, changes *[]FieldChange) {
+	keys := map[string]struct{}{}
+	for k := range from {
+		keys[k] = struct{}{}
+	}
+	for k := range to {
+		keys[k] = struct{}{}
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	for _, k := range sorted {
+		keyPath := joinPath(path, k)
+		if _, ignored := ignoredDiffPaths[keyPath]; ignored {
+			continue
+		}
+		fromValue, inFrom := from[k]
+		toValue, inTo := to[k]
+		switch {
+		case !inFrom:
+			*changes = append(*changes, FieldChange{Type: FieldAdded, Path: keyPath, New: toValue})
+		case !inTo:
+			*changes = append(*changes, FieldChange{Type: FieldRemoved, Path: keyPath, Old: fromValue})
+		default:
+			diffValue(keyPath, fromValue, toValue, changes)
+		}
+	}
+}
+
+// joinPath quotes keys such as label names that contain dots or slashes.
+func joinPath(path string, key string) string {
+	if strings.ContainsAny(key, "./") {
+		return fmt.Sprintf("%s[%q]", path, key)
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
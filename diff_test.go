@@ -0,0 +1,61 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestDiffUnstructured(t *testing.T) {
+	live := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "Deployment",
+		"metadata": map[string]interface{}{
+			"name":            "web",
+			"resourceVersion": "10",
+			"labels":          map[string]interface{}{"app.kubernetes.io/name": "web", "tier": "front"},
+		},
+		"spec": map[string]interface{}{
+			"replicas": int64(1),
+			"template": map[string]interface{}{"spec": map[string]interface{}{
+				"containers": []interface{}{
+					map[string]interface{}{"name": "web", "image": "nginx:1.12"},
+				},
+			}},
+		},
+	}}
+	desired := live.DeepCopy()
+	desired.SetResourceVersion("11")
+	desired.SetLabels(map[string]string{"app.kubernetes.io/name": "web", "release": "r1"})
+	unstructured.SetNestedField(desired.Object, int64(3), "spec", "replicas")
+	unstructured.SetNestedSlice(desired.Object, []interface{}{
+		map[string]interface{}{"name": "web", "image": "nginx:1.21"},
+		map[string]interface{}{"name": "sidecar", "image": "envoy"},
+	}, "spec", "template", "spec", "containers")
+
+	changes := DiffUnstructured(live, desired)
+
+	assert.Equal(t, []FieldChange{
+		{Type: FieldAdded, Path: "metadata.labels.release", New: "r1"},
+		{Type: FieldRemoved, Path: "metadata.labels.tier", Old: "front"},
+		{Type: FieldChanged, Path: "spec.replicas", Old: int64(1), New: int64(3)},
+		{Type: FieldChanged, Path: "spec.template.spec.containers[0].image", Old: "nginx:1.12", New: "nginx:1.21"},
+		{Type: FieldAdded, Path: "spec.template.spec.containers[1]", New: map[string]interface{}{"name": "sidecar", "image": "envoy"}},
+	}, changes)
+	assert.Equal(t, "~ spec.replicas: 1 -> 3", changes[2].String())
+	assert.Equal(t, `metadata.labels["app.kubernetes.io/name"]`, joinPath("metadata.labels", "app.kubernetes.io/name"))
+}
+
+func TestDiffUnstructuredNewObject(t *testing.T) {
+	desired := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "web"},
+	}}
+
+	changes := DiffUnstructured(nil, desired)
+
+	assert.Len(t, changes, 3)
+	assert.Equal(t, FieldAdded, changes[0].Type)
+	assert.Equal(t, "apiVersion", changes[0].Path)
+}
@@ -0,0 +1,274 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	EndpointSliceKind = "EndpointSlice"
+
+	// endpointSliceManager is the managed-by label value of the slices
+	// SyncServiceBackends owns, the EndpointSlice controller leaves them alone.
+	endpointSliceManager = "cg-controller"
+
+	maxEndpointsPerSlice = 1000
+)
+
+// EndpointBackend is one address behind a service. Conditions left nil count
+// as ready, like in the API.
+type EndpointBackend struct {
+	Address    string // IPv4, IPv6 or a FQDN
+	Hostname   string
+	NodeName   string
+	Zone       string
+	Conditions discoveryv1.EndpointConditions
+	ForZones   []string // topology hints, zones whose clients should use this endpoint
+}
+
+type EndpointPortSpec struct {
+	Name     string
+	Protocol v1.Protocol // defaults to TCP
+	Port     int32
+}
+
+// EndpointSliceSpec describes an EndpointSlice for CreateEndpointSlice. The
+// address type is derived from the addresses, which must all be of one type.
+type EndpointSliceSpec struct {
+	Name        string
+	ServiceName string
+	Labels      map[string]string
+	Ports       []EndpointPortSpec
+	Endpoints   []EndpointBackend
+}
+
+func NewEndpointSliceSpec(name string, servicename string) *EndpointSliceSpec {
+	return &EndpointSliceSpec{Name: name, ServiceName: servicename}
+}
+
+func (s *EndpointSliceSpec) WithLabel(key string, value string) *EndpointSliceSpec {
+	s.Labels = setKey(s.Labels, key, value)
+	return s
+}
+
+func (s *EndpointSliceSpec) WithPort(name string, protocol v1.Protocol, port int32) *EndpointSliceSpec {
+	s.Ports = append(s.Ports, EndpointPortSpec{Name: name, Protocol: protocol, Port: port})
+	return s
+}
+
+func (s *EndpointSliceSpec) WithEndpoint(backend EndpointBackend) *EndpointSliceSpec {
+	s.Endpoints = append(s.Endpoints, backend)
+	return s
+}
+
+// AddressTypeOf returns the EndpointSlice address type of address.
+func AddressTypeOf(address string) (discoveryv1.AddressType, error) {
+	if ip := net.ParseIP(address); ip != nil {
+		if ip.To4() != nil {
+			return discoveryv1.AddressTypeIPv4, nil
+		}
+		return discoveryv1.AddressTypeIPv6, nil
+	}
+	if errs := validation.IsDNS1123Subdomain(address); len(errs) > 0 {
+		return "", fmt.Errorf("address %q is neither an IP nor a FQDN: %s", address, strings.Join(errs, ", "))
+	}
+	return discoveryv1.AddressTypeFQDN, nil
+}
+
+// EndpointSlice returns the discovery.k8s.io/v1 EndpointSlice described by the spec.
+func (s *EndpointSliceSpec) EndpointSlice(namespace string) (*discoveryv1.EndpointSlice, error) {
+	if s.Name == "" {
+		return nil, errors.New("endpoint slice name is required")
+	}
+	if len(s.Endpoints) > maxEndpointsPerSlice {
+		return nil, fmt.Errorf("endpoint slice %s has %d endpoints, at most %d fit", s.Name, len(s.Endpoints), maxEndpointsPerSlice)
+	}
+
+	slice := &discoveryv1.EndpointSlice{
+		TypeMeta: metav1.TypeMeta{APIVersion: discoveryv1.SchemeGroupVersion.String(), Kind: EndpointSliceKind},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      s.Name,
+			Namespace: namespace,
+			Labels:    s.Labels,
+		},
+	}
+	if s.ServiceName != "" {
+		slice.Labels = setKey(slice.Labels, discoveryv1.LabelServiceName, s.ServiceName)
+	}
+
+	for _, backend := range s.Endpoints {
+		addressType, err := AddressTypeOf(backend.Address)
+		if err != nil {
+			return nil, fmt.Errorf("endpoint slice %s: %w", s.Name, err)
+		}
+		if slice.AddressType == "" {
+			slice.AddressType = addressType
+		} else if slice.AddressType != addressType {
+			return nil, fmt.Errorf("endpoint slice %s: %s address %s in a slice of %s addresses", s.Name, addressType, backend.Address, slice.AddressType)
+		}
+
+		endpoint := discoveryv1.Endpoint{Addresses: []string{backend.Address}, Conditions: backend.Conditions}
+		if backend.Hostname != "" {
+			hostname := backend.Hostname
+			endpoint.Hostname = &hostname
+		}
+		if backend.NodeName != "" {
+			nodeName := backend.NodeName
+			endpoint.NodeName = &nodeName
+		}
+		if backend.Zone != "" {
+			zone := backend.Zone
+			endpoint.Zone = &zone
+		}
+		if len(backend.ForZones) > 0 {
+			endpoint.Hints = &discoveryv1.EndpointHints{}
+			for _, zone := range backend.ForZones {
+				endpoint.Hints.ForZones = append(endpoint.Hints.ForZones, discoveryv1.ForZone{Name: zone})
+			}
+		}
+		slice.Endpoints = append(slice.Endpoints, endpoint)
+	}
+	if slice.AddressType == "" {
+		// an empty slice still needs a type, IPv4 is what the API server defaults services to
+		slice.AddressType = discoveryv1.AddressTypeIPv4
+	}
+
+	for _, port := range s.Ports {
+		name, portNumber, protocol := port.Name, port.Port, port.Protocol
+		if protocol == "" {
+			protocol = v1.ProtocolTCP
+		}
+		slice.Ports = append(slice.Ports, discoveryv1.EndpointPort{Name: &name, Port: &portNumber, Protocol: &protocol})
+	}
+	return slice, nil
+}
+
+func (c *KubernetesClient) CreateEndpointSlice(ctx context.Context, namespace string, spec *EndpointSliceSpec) (*discoveryv1.EndpointSlice, error) {
+	gvk := discoveryv1.SchemeGroupVersion.WithKind(EndpointSliceKind)
+	slice, err := spec.EndpointSlice(namespace)
+	if err != nil {
+		return nil, objectError("create", gvk, namespace, spec.Name, err)
+	}
+	result, err := c.clientset.DiscoveryV1().EndpointSlices(namespace).Create(ctx, slice, metav1.CreateOptions{})
+	if err != nil {
+		return nil, objectError("create", gvk, namespace, spec.Name, err)
+	}
+	fmt.Printf("Created endpoint slice %s\n", result.Name)
+	return result, nil
+}
+
+func (c *KubernetesClient) ListEndpointSlices(ctx context.Context, namespace string, opts ...ListOptions) (*discoveryv1.EndpointSliceList, error) {
+	return c.clientset.DiscoveryV1().EndpointSlices(namespace).List(ctx, listOptions(opts))
+}
+
+// ListServiceEndpointSlices returns the slices of service, whoever manages them.
+func (c *KubernetesClient) ListServiceEndpointSlices(ctx context.Context, namespace string, servicename string) (*discoveryv1.EndpointSliceList, error) {
+	selector := labels.Set{discoveryv1.LabelServiceName: servicename}.String()
+	return c.ListEndpointSlices(ctx, namespace, ListOptions{LabelSelector: selector})
+}
+
+// UpdateEndpointSlice replaces slice, it must carry the resourceVersion it was read with.
+func (c *KubernetesClient) UpdateEndpointSlice(ctx context.Context, slice *discoveryv1.EndpointSlice) (*discoveryv1.EndpointSlice, error) {
+	result, err := c.clientset.DiscoveryV1().EndpointSlices(slice.Namespace).Update(ctx, slice, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, objectError("update", discoveryv1.SchemeGroupVersion.WithKind(EndpointSliceKind), slice.Namespace, slice.Name, err)
+	}
+	return result, nil
+}
+
+func (c *KubernetesClient) DeleteEndpointSlice(ctx context.Context, namespace string, name string) error {
+	err := c.clientset.DiscoveryV1().EndpointSlices(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	return objectError("delete", discoveryv1.SchemeGroupVersion.WithKind(EndpointSliceKind), namespace, name, err)
+}
+
+// SyncServiceBackends points a service without selector at backends, e.g. a
+// database outside the cluster. It keeps one slice per address type, named
+// <service>-ipv4, <service>-ipv6 and <service>-fqdn, and removes the slices
+// of address types no longer in backends. Slices of other managers are left
+// alone; do not also create Endpoints for the service, the API server mirrors
+// those into slices of its own.
+func (c *KubernetesClient) SyncServiceBackends(ctx context.Context, namespace string, servicename string, ports []EndpointPortSpec, backends []EndpointBackend) error {
+	gvk := discoveryv1.SchemeGroupVersion.WithKind(EndpointSliceKind)
+	service, err := c.clientset.CoreV1().Services(namespace).Get(ctx, servicename, metav1.GetOptions{})
+	if err != nil {
+		return objectError("sync", v1.SchemeGroupVersion.WithKind(ServiceKind), namespace, servicename, err)
+	}
+	if len(service.Spec.Selector) > 0 {
+		return objectError("sync", v1.SchemeGroupVersion.WithKind(ServiceKind), namespace, servicename,
+			errors.New("service has a selector, its endpoints are managed by the cluster"))
+	}
+
+	specs := map[discoveryv1.AddressType]*EndpointSliceSpec{}
+	for _, backend := range backends {
+		addressType, err := AddressTypeOf(backend.Address)
+		if err != nil {
+			return objectError("sync", gvk, namespace, servicename, err)
+		}
+		spec, ok := specs[addressType]
+		if !ok {
+			spec = NewEndpointSliceSpec(servicename+"-"+strings.ToLower(string(addressType)), servicename).
+				WithLabel(discoveryv1.LabelManagedBy, endpointSliceManager)
+			spec.Ports = ports
+			specs[addressType] = spec
+		}
+		spec.WithEndpoint(backend)
+	}
+
+	existing, err := c.ListEndpointSlices(ctx, namespace, ListOptions{LabelSelector: labels.Set{
+		discoveryv1.LabelServiceName: servicename,
+		discoveryv1.LabelManagedBy:   endpointSliceManager,
+	}.String()})
+	if err != nil {
+		return objectError("list", gvk, namespace, "", err)
+	}
+	current := map[string]*discoveryv1.EndpointSlice{}
+	for i := range existing.Items {
+		current[existing.Items[i].Name] = &existing.Items[i]
+	}
+
+	addressTypes := make([]string, 0, len(specs))
+	for addressType := range specs {
+		addressTypes = append(addressTypes, string(addressType))
+	}
+	sort.Strings(addressTypes)
+	for _, addressType := range addressTypes {
+		spec := specs[discoveryv1.AddressType(addressType)]
+		desired, err := spec.EndpointSlice(namespace)
+		if err != nil {
+			return objectError("sync", gvk, namespace, spec.Name, err)
+		}
+		slice, ok := current[spec.Name]
+		delete(current, spec.Name)
+		if !ok {
+			if _, err := c.clientset.DiscoveryV1().EndpointSlices(namespace).Create(ctx, desired, metav1.CreateOptions{}); err != nil {
+				return objectError("create", gvk, namespace, spec.Name, err)
+			}
+			fmt.Printf("Created endpoint slice %s\n", spec.Name)
+			continue
+		}
+		slice.Labels = mergeKeys(slice.Labels, desired.Labels)
+		slice.Endpoints = desired.Endpoints
+		slice.Ports = desired.Ports
+		if _, err := c.UpdateEndpointSlice(ctx, slice); err != nil {
+			return err
+		}
+	}
+
+	for name := range current {
+		if err := c.DeleteEndpointSlice(ctx, namespace, name); err != nil && !IsNotFound(err) {
+			return err
+		}
+		fmt.Printf("Deleted endpoint slice %s\n", name)
+	}
+	return nil
+}
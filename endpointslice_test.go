@@ -0,0 +1,121 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAddressTypeOf(t *testing.T) {
+	for address, expected := range map[string]discoveryv1.AddressType{
+		"10.0.0.1":       discoveryv1.AddressTypeIPv4,
+		"fd00::1":        discoveryv1.AddressTypeIPv6,
+		"db.example.com": discoveryv1.AddressTypeFQDN,
+	} {
+		addressType, err := AddressTypeOf(address)
+		assert.Nil(t, err, address)
+		assert.Equal(t, expected, addressType, address)
+	}
+	_, err := AddressTypeOf("not an address")
+	assert.NotNil(t, err)
+}
+
+func TestEndpointSliceSpec(t *testing.T) {
+	ready, notReady := true, false
+	slice, err := NewEndpointSliceSpec("db-1", "db").
+		WithPort("postgres", "", 5432).
+		WithEndpoint(EndpointBackend{Address: "10.0.0.1", Zone: "us-east-1a", ForZones: []string{"us-east-1a"}, Conditions: discoveryv1.EndpointConditions{Ready: &ready}}).
+		WithEndpoint(EndpointBackend{Address: "10.0.0.2", Hostname: "replica", Conditions: discoveryv1.EndpointConditions{Ready: &notReady}}).
+		EndpointSlice("default")
+	assert.Nil(t, err)
+	assert.Equal(t, discoveryv1.AddressTypeIPv4, slice.AddressType)
+	assert.Equal(t, "db", slice.Labels[discoveryv1.LabelServiceName])
+	assert.Len(t, slice.Endpoints, 2)
+	assert.Equal(t, "us-east-1a", *slice.Endpoints[0].Zone)
+	assert.Equal(t, []discoveryv1.ForZone{{Name: "us-east-1a"}}, slice.Endpoints[0].Hints.ForZones)
+	assert.False(t, *slice.Endpoints[1].Conditions.Ready)
+	assert.Equal(t, "replica", *slice.Endpoints[1].Hostname)
+	assert.Equal(t, v1.ProtocolTCP, *slice.Ports[0].Protocol)
+
+	_, err = NewEndpointSliceSpec("mixed", "db").
+		WithEndpoint(EndpointBackend{Address: "10.0.0.1"}).
+		WithEndpoint(EndpointBackend{Address: "fd00::1"}).
+		EndpointSlice("default")
+	assert.NotNil(t, err)
+}
+
+func TestFakeEndpointSlices(t *testing.T) {
+	client := newFakeCluster().client
+	ctx := context.Background()
+
+	_, err := client.CreateEndpointSlice(ctx, "default", NewEndpointSliceSpec("db-1", "db").
+		WithPort("postgres", v1.ProtocolTCP, 5432).
+		WithEndpoint(EndpointBackend{Address: "db.example.com"}))
+	assert.Nil(t, err)
+	_, err = client.CreateEndpointSlice(ctx, "default", NewEndpointSliceSpec("cache-1", "cache").
+		WithEndpoint(EndpointBackend{Address: "10.0.0.9"}))
+	assert.Nil(t, err)
+
+	slices, err := client.ListServiceEndpointSlices(ctx, "default", "db")
+	assert.Nil(t, err)
+	assert.Len(t, slices.Items, 1)
+	slice := slices.Items[0]
+	assert.Equal(t, discoveryv1.AddressTypeFQDN, slice.AddressType)
+
+	slice.Endpoints = append(slice.Endpoints, discoveryv1.Endpoint{Addresses: []string{"db2.example.com"}})
+	updated, err := client.UpdateEndpointSlice(ctx, &slice)
+	assert.Nil(t, err)
+	assert.Len(t, updated.Endpoints, 2)
+
+	assert.Nil(t, client.DeleteEndpointSlice(ctx, "default", "db-1"))
+	assert.True(t, IsNotFound(client.DeleteEndpointSlice(ctx, "default", "db-1")))
+}
+
+func TestFakeSyncServiceBackends(t *testing.T) {
+	cluster := newFakeCluster(
+		&v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default"}},
+		&v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}, Spec: v1.ServiceSpec{Selector: map[string]string{"app": "web"}}},
+	)
+	client := cluster.client
+	ctx := context.Background()
+	ports := []EndpointPortSpec{{Name: "postgres", Port: 5432}}
+	names := func() []string {
+		slices, err := client.ListServiceEndpointSlices(ctx, "default", "db")
+		assert.Nil(t, err)
+		var names []string
+		for _, slice := range slices.Items {
+			names = append(names, slice.Name)
+		}
+		return names
+	}
+
+	assert.Nil(t, client.SyncServiceBackends(ctx, "default", "db", ports, []EndpointBackend{
+		{Address: "10.0.0.1"}, {Address: "10.0.0.2"}, {Address: "fd00::1"},
+	}))
+	assert.ElementsMatch(t, []string{"db-ipv4", "db-ipv6"}, names())
+	slice, err := cluster.clientset.DiscoveryV1().EndpointSlices("default").Get(ctx, "db-ipv4", metav1.GetOptions{})
+	assert.Nil(t, err)
+	slice.Labels["team"] = "data"
+	_, err = cluster.clientset.DiscoveryV1().EndpointSlices("default").Update(ctx, slice, metav1.UpdateOptions{})
+	assert.Nil(t, err)
+
+	// IPv6 goes away, one IPv4 backend is replaced, labels of others are kept
+	assert.Nil(t, client.SyncServiceBackends(ctx, "default", "db", ports, []EndpointBackend{
+		{Address: "10.0.0.1"}, {Address: "10.0.0.3"},
+	}))
+	assert.Equal(t, []string{"db-ipv4"}, names())
+	slice, err = cluster.clientset.DiscoveryV1().EndpointSlices("default").Get(ctx, "db-ipv4", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "data", slice.Labels["team"])
+	assert.Equal(t, []string{"10.0.0.3"}, slice.Endpoints[1].Addresses)
+	assert.Equal(t, endpointSliceManager, slice.Labels[discoveryv1.LabelManagedBy])
+
+	assert.Nil(t, client.SyncServiceBackends(ctx, "default", "db", ports, nil))
+	assert.Empty(t, names())
+
+	assert.NotNil(t, client.SyncServiceBackends(ctx, "default", "web", ports, nil))
+}
@@ -0,0 +1,62 @@
+package kubernetes
+
+import (
+	"errors"
+	"fmt"
+
+	"code.cargurus.com/platform/glados/pkg/util"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ErrDecode is wrapped by every error caused by a manifest that cannot be decoded.
+var ErrDecode = errors.New("decode failed")
+
+// ObjectError attaches the operation and the object it was applied to to an API error.
+type ObjectError struct {
+	Op        string
+	GVK       schema.GroupVersionKind
+	Namespace string
+	Name      string
+	Err       error
+}
+
+func (e *ObjectError) Error() string {
+	ref := e.Name
+	if e.Namespace != "" {
+		ref = e.Namespace + "/" + e.Name
+	}
+	return fmt.Sprintf("%s %s.%s %s: %v", e.Op, e.GVK.Kind, e.GVK.GroupVersion().String(), ref, e.Err)
+}
+
+func (e *ObjectError) Unwrap() error {
+	return e.Err
+}
+
+func objectError(op string, gvk schema.GroupVersionKind, namespace string, name string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &ObjectError{Op: op, GVK: gvk, Namespace: namespace, Name: name, Err: err}
+}
+
+func decodeError(err error) error {
+	return fmt.Errorf("%w: %v", ErrDecode, err)
+}
+
+// IsConflict reports whether the object already exists or was modified concurrently.
+func IsConflict(err error) bool {
+	return apierrors.IsAlreadyExists(err) || apierrors.IsConflict(err)
+}
+
+func IsNotFound(err error) bool {
+	return apierrors.IsNotFound(err) || errors.Is(err, util.ErrNotFound)
+}
+
+func IsForbidden(err error) bool {
+	return apierrors.IsForbidden(err)
+}
+
+func IsDecodeError(err error) bool {
+	return errors.Is(err, ErrDecode)
+}
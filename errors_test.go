@@ -0,0 +1,43 @@
+package kubernetes
+
+import (
+	"errors"
+	"testing"
+
+	"code.cargurus.com/platform/glados/pkg/util"
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestObjectError(t *testing.T) {
+	gvk := schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: DeploymentKind}
+	gr := schema.GroupResource{Group: "apps", Resource: "deployments"}
+	err := objectError("create", gvk, "default", "web", apierrors.NewAlreadyExists(gr, "web"))
+
+	assert.EqualError(t, err, `create Deployment.apps/v1 default/web: deployments.apps "web" already exists`)
+	assert.True(t, IsConflict(err))
+	assert.False(t, IsNotFound(err))
+
+	var objErr *ObjectError
+	assert.True(t, errors.As(err, &objErr))
+	assert.Equal(t, "web", objErr.Name)
+	assert.Nil(t, objectError("create", gvk, "default", "web", nil))
+}
+
+func TestErrorPredicates(t *testing.T) {
+	gvk := schema.GroupVersionKind{Version: "v1", Kind: ServiceKind}
+	gr := schema.GroupResource{Resource: "services"}
+
+	assert.True(t, IsNotFound(objectError("delete", gvk, "default", "web", apierrors.NewNotFound(gr, "web"))))
+	assert.True(t, IsNotFound(util.ErrNotFound))
+	assert.True(t, IsForbidden(objectError("delete", gvk, "default", "web", apierrors.NewForbidden(gr, "web", errors.New("rbac")))))
+	assert.True(t, IsConflict(apierrors.NewConflict(gr, "web", errors.New("modified"))))
+}
+
+func TestDecodeError(t *testing.T) {
+	_, err := decodeObject("metadata: {name: no-kind}")
+
+	assert.True(t, IsDecodeError(err))
+	assert.False(t, IsNotFound(err))
+}
@@ -0,0 +1,182 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	netv1beta1 "k8s.io/api/networking/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/cache"
+)
+
+// EventHandlerFuncs receive typed objects: kinds known to client-go
+// (Deployment, Service, ...) arrive as their typed struct, anything else,
+// e.g. CRD instances, as *unstructured.Unstructured. Nil funcs are skipped.
+type EventHandlerFuncs struct {
+	AddFunc    func(obj runtime.Object)
+	UpdateFunc func(oldObj, newObj runtime.Object)
+	DeleteFunc func(obj runtime.Object)
+}
+
+// EventWatcher dispatches events of shared dynamic informers to per-GVK
+// handlers. The informers relist when a watch expires, use resourceVersion
+// bookmarks to resume watches cheaply and resync handlers every resync period.
+type EventWatcher struct {
+	client  *KubernetesClient
+	factory dynamicinformer.DynamicSharedInformerFactory
+
+	mu      sync.Mutex
+	started bool
+	ctx     context.Context
+}
+
+// NewEventWatcher watches namespace, "" for all namespaces. A resync of 0 disables resyncs.
+func (c *KubernetesClient) NewEventWatcher(namespace string, resync time.Duration) *EventWatcher {
+	return &EventWatcher{
+		client:  c,
+		factory: dynamicinformer.NewFilteredDynamicSharedInformerFactory(c.dynamicinterface, resync, namespace, nil),
+	}
+}
+
+// AddHandler registers handler for events of gvk. Handlers added after Start
+// get their informer started right away.
+func (w *EventWatcher) AddHandler(gvk schema.GroupVersionKind, handler EventHandlerFuncs) error {
+	mapping, err := w.client.restMapping(gvk)
+	if err != nil {
+		return objectError("watch", gvk, "", "", err)
+	}
+	informer := w.factory.ForResource(mapping.Resource).Informer()
+	_, err = informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if handler.AddFunc != nil {
+				handler.AddFunc(toTyped(obj))
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if handler.UpdateFunc != nil {
+				handler.UpdateFunc(toTyped(oldObj), toTyped(newObj))
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if handler.DeleteFunc != nil {
+				handler.DeleteFunc(toTyped(obj))
+			}
+		},
+	})
+	if err != nil {
+		return objectError("watch", gvk, "", "", err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.started {
+		w.factory.Start(w.ctx.Done())
+		if !cache.WaitForCacheSync(w.ctx.Done(), informer.HasSynced) {
+			return objectError("watch", gvk, "", "", fmt.Errorf("cache did not sync: %w", w.ctx.Err()))
+		}
+	}
+	return nil
+}
+
+// Start runs the informers until ctx is cancelled and waits for their caches to sync.
+func (w *EventWatcher) Start(ctx context.Context) error {
+	w.mu.Lock()
+	w.started = true
+	w.ctx = ctx
+	w.factory.Start(ctx.Done())
+	w.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		w.factory.Shutdown()
+	}()
+
+	for resource, synced := range w.factory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return fmt.Errorf("cache for %s did not sync: %w", resource.String(), ctx.Err())
+		}
+	}
+	return nil
+}
+
+// toTyped converts an informer object to its typed struct when the kind is
+// registered with client-go, deleted objects are unwrapped from their tombstone.
+func toTyped(obj interface{}) runtime.Object {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		if o, ok := obj.(runtime.Object); ok {
+			return o
+		}
+		return nil
+	}
+	typed, err := scheme.Scheme.New(u.GroupVersionKind())
+	if err != nil {
+		return u
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, typed); err != nil {
+		return u
+	}
+	typed.GetObjectKind().SetGroupVersionKind(u.GroupVersionKind())
+	return typed
+}
+
+// PrintEventHandler prints every event it receives, handy to explore what a cluster does.
+func PrintEventHandler() EventHandlerFuncs {
+	return EventHandlerFuncs{
+		AddFunc: func(obj runtime.Object) {
+			printEvent("ADDED", obj)
+		},
+		UpdateFunc: func(oldObj, newObj runtime.Object) {
+			printEvent("MODIFIED", newObj)
+		},
+		DeleteFunc: func(obj runtime.Object) {
+			printEvent("DELETED", obj)
+		},
+	}
+}
+
+func printEvent(eventType string, obj runtime.Object) {
+	fmt.Printf("event %s Kind -> : %s \n", eventType, obj.GetObjectKind().GroupVersionKind().Kind)
+
+	switch s := obj.(type) {
+	case *appsv1.Deployment:
+		fmt.Println("Name:", s.Name, " namespace: ", s.Namespace, " spec replicas:", replicasOf(s.Spec.Replicas), " status Replicas:", s.Status.Replicas, " status ReadyReplicas:", s.Status.ReadyReplicas)
+	case *appsv1.StatefulSet:
+		fmt.Println("Name:", s.Name, " namespace: ", s.Namespace, " spec replicas:", replicasOf(s.Spec.Replicas), " status Replicas:", s.Status.Replicas, " status ReadyReplicas:", s.Status.ReadyReplicas)
+	case *appsv1.DaemonSet:
+		fmt.Println("Name:", s.Name, " namespace: ", s.Namespace, " desired:", s.Status.DesiredNumberScheduled, " ready:", s.Status.NumberReady)
+	case *v1.Service:
+		fmt.Println("Name:", s.Name, " namespace: ", s.Namespace)
+	case *v1.ConfigMap:
+		fmt.Println("Name:", s.Name, " namespace: ", s.Namespace)
+	case *v1.Secret:
+		fmt.Println("Name:", s.Name, " namespace: ", s.Namespace)
+	case *v1.ServiceAccount:
+		fmt.Println("Name:", s.Name, " namespace: ", s.Namespace)
+	case *netv1.Ingress:
+		fmt.Println("Name:", s.Name, " namespace: ", s.Namespace, " status: ", s.Status, " spec: ", s.Spec)
+	case *netv1beta1.Ingress:
+		fmt.Println("Name:", s.Name, " namespace: ", s.Namespace, " status: ", s.Status, " spec: ", s.Spec)
+	case *unstructured.Unstructured:
+		fmt.Println("Name:", s.GetName(), " namespace: ", s.GetNamespace())
+	}
+}
+
+func replicasOf(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
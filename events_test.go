@@ -0,0 +1,71 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestEventWatcherTypedHandlers(t *testing.T) {
+	deployments := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	cluster := newFakeCluster()
+	client, dyn := cluster.client, cluster.dynamic
+
+	added := make(chan runtime.Object, 1)
+	deleted := make(chan runtime.Object, 1)
+	watcher := client.NewEventWatcher("default", 0)
+	err := watcher.AddHandler(appsv1.SchemeGroupVersion.WithKind(DeploymentKind), EventHandlerFuncs{
+		AddFunc:    func(obj runtime.Object) { added <- obj },
+		DeleteFunc: func(obj runtime.Object) { deleted <- obj },
+	})
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.Nil(t, watcher.Start(ctx))
+
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "default"},
+		"spec":       map[string]interface{}{"replicas": int64(3)},
+	}}
+	_, err = dyn.Resource(deployments).Namespace("default").Create(ctx, deployment, metav1.CreateOptions{})
+	assert.Nil(t, err)
+
+	select {
+	case obj := <-added:
+		typed, ok := obj.(*appsv1.Deployment)
+		assert.True(t, ok)
+		assert.Equal(t, "web", typed.Name)
+		assert.Equal(t, int32(3), *typed.Spec.Replicas)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no add event")
+	}
+
+	err = dyn.Resource(deployments).Namespace("default").Delete(ctx, "web", metav1.DeleteOptions{})
+	assert.Nil(t, err)
+	select {
+	case obj := <-deleted:
+		assert.IsType(t, &appsv1.Deployment{}, obj)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no delete event")
+	}
+}
+
+func TestToTypedKeepsUnknownKinds(t *testing.T) {
+	monitor := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "monitoring.coreos.com/v1",
+		"kind":       ServiceMonitorKind,
+		"metadata":   map[string]interface{}{"name": "redis"},
+	}}
+
+	assert.Equal(t, monitor, toTyped(monitor))
+}
@@ -0,0 +1,157 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	netv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// IngressRoute sends host and path to a service port. ServicePortName is used when ServicePort is 0.
+type IngressRoute struct {
+	Host            string         // "" matches every host
+	Path            string         // defaults to "/"
+	PathType        netv1.PathType // defaults to Prefix
+	ServiceName     string
+	ServicePort     int32
+	ServicePortName string
+}
+
+// IngressSpec describes an Ingress for CreateIngressFromSpec. Routes of the
+// same host end up in one rule.
+type IngressSpec struct {
+	Name        string
+	ClassName   string // "" leaves the choice to the default IngressClass
+	Labels      map[string]string
+	Annotations map[string]string
+	Routes      []IngressRoute
+	TLS         []netv1.IngressTLS
+}
+
+func NewIngressSpec(name string) *IngressSpec {
+	return &IngressSpec{Name: name}
+}
+
+func (s *IngressSpec) WithClass(className string) *IngressSpec {
+	s.ClassName = className
+	return s
+}
+
+func (s *IngressSpec) WithLabel(key string, value string) *IngressSpec {
+	s.Labels = setKey(s.Labels, key, value)
+	return s
+}
+
+// WithAnnotation sets controller specific options, e.g. "nginx.ingress.kubernetes.io/rewrite-target".
+func (s *IngressSpec) WithAnnotation(key string, value string) *IngressSpec {
+	s.Annotations = setKey(s.Annotations, key, value)
+	return s
+}
+
+// WithRoute sends host and path prefix to port of service.
+func (s *IngressSpec) WithRoute(host string, path string, service string, port int32) *IngressSpec {
+	s.Routes = append(s.Routes, IngressRoute{Host: host, Path: path, ServiceName: service, ServicePort: port})
+	return s
+}
+
+// WithTLS terminates TLS for hosts with the certificate in the kubernetes.io/tls Secret secretName.
+func (s *IngressSpec) WithTLS(secretName string, hosts ...string) *IngressSpec {
+	s.TLS = append(s.TLS, netv1.IngressTLS{SecretName: secretName, Hosts: hosts})
+	return s
+}
+
+// Ingress returns the networking.k8s.io/v1 Ingress described by the spec.
+func (s *IngressSpec) Ingress(namespace string) (*netv1.Ingress, error) {
+	if s.Name == "" {
+		return nil, errors.New("ingress name is required")
+	}
+	if len(s.Routes) == 0 {
+		return nil, fmt.Errorf("ingress %s needs at least one route", s.Name)
+	}
+
+	ingress := &netv1.Ingress{
+		TypeMeta: metav1.TypeMeta{APIVersion: netv1.SchemeGroupVersion.String(), Kind: IngressKind},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        s.Name,
+			Namespace:   namespace,
+			Labels:      s.Labels,
+			Annotations: s.Annotations,
+		},
+		Spec: netv1.IngressSpec{TLS: s.TLS},
+	}
+	if s.ClassName != "" {
+		className := s.ClassName
+		ingress.Spec.IngressClassName = &className
+	}
+
+	rules := map[string]int{}
+	for _, route := range s.Routes {
+		if route.ServiceName == "" || (route.ServicePort == 0 && route.ServicePortName == "") {
+			return nil, fmt.Errorf("ingress %s: route %s%s needs a service and port", s.Name, route.Host, route.Path)
+		}
+		pathType := route.PathType
+		if pathType == "" {
+			pathType = netv1.PathTypePrefix
+		}
+		port := netv1.ServiceBackendPort{Number: route.ServicePort}
+		if route.ServicePort == 0 {
+			port.Name = route.ServicePortName
+		}
+		path := netv1.HTTPIngressPath{
+			Path:     route.Path,
+			PathType: &pathType,
+			Backend:  netv1.IngressBackend{Service: &netv1.IngressServiceBackend{Name: route.ServiceName, Port: port}},
+		}
+		if path.Path == "" {
+			path.Path = "/"
+		}
+
+		i, ok := rules[route.Host]
+		if !ok {
+			i = len(ingress.Spec.Rules)
+			rules[route.Host] = i
+			ingress.Spec.Rules = append(ingress.Spec.Rules, netv1.IngressRule{
+				Host:             route.Host,
+				IngressRuleValue: netv1.IngressRuleValue{HTTP: &netv1.HTTPIngressRuleValue{}},
+			})
+		}
+		ingress.Spec.Rules[i].HTTP.Paths = append(ingress.Spec.Rules[i].HTTP.Paths, path)
+	}
+	return ingress, nil
+}
+
+func (c *KubernetesClient) CreateIngressFromSpec(ctx context.Context, namespace string, spec *IngressSpec) (*netv1.Ingress, error) {
+	ingress, err := spec.Ingress(namespace)
+	if err != nil {
+		return nil, objectError("create", netv1.SchemeGroupVersion.WithKind(IngressKind), namespace, spec.Name, err)
+	}
+	return c.CreateIngress(ctx, ingress)
+}
+
+// ExposeService makes port of service reachable at host through an Ingress
+// named after the service. A tlsSecret enables TLS for host.
+func (c *KubernetesClient) ExposeService(ctx context.Context, namespace string, servicename string, port int32, host string, tlsSecret string) (*netv1.Ingress, error) {
+	spec := NewIngressSpec(servicename).WithRoute(host, "/", servicename, port)
+	if tlsSecret != "" {
+		spec.WithTLS(tlsSecret, host)
+	}
+	return c.CreateIngressFromSpec(ctx, namespace, spec)
+}
+
+// ApplicationOption adds optional parts to CreateApplicationService.
+type ApplicationOption func(*applicationOptions)
+
+type applicationOptions struct {
+	ingress *IngressSpec
+}
+
+// WithIngress creates spec along with the application, an Ingress without a
+// name is named after the application. It is created last and rolled back
+// with the rest.
+func WithIngress(spec *IngressSpec) ApplicationOption {
+	return func(o *applicationOptions) {
+		o.ingress = spec
+	}
+}
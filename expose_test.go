@@ -0,0 +1,99 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestIngressSpec(t *testing.T) {
+	ingress, err := NewIngressSpec("web").
+		WithClass("nginx").
+		WithAnnotation("nginx.ingress.kubernetes.io/ssl-redirect", "true").
+		WithRoute("web.example.com", "/", "web", 80).
+		WithRoute("web.example.com", "/api", "api", 8080).
+		WithRoute("admin.example.com", "", "admin", 80).
+		WithTLS("web-tls", "web.example.com", "admin.example.com").
+		Ingress("default")
+	assert.Nil(t, err)
+
+	assert.Equal(t, "nginx", *ingress.Spec.IngressClassName)
+	assert.Equal(t, "true", ingress.Annotations["nginx.ingress.kubernetes.io/ssl-redirect"])
+	assert.Len(t, ingress.Spec.Rules, 2)
+	assert.Equal(t, "web.example.com", ingress.Spec.Rules[0].Host)
+	assert.Len(t, ingress.Spec.Rules[0].HTTP.Paths, 2)
+	api := ingress.Spec.Rules[0].HTTP.Paths[1]
+	assert.Equal(t, "/api", api.Path)
+	assert.Equal(t, netv1.PathTypePrefix, *api.PathType)
+	assert.Equal(t, int32(8080), api.Backend.Service.Port.Number)
+	assert.Equal(t, "/", ingress.Spec.Rules[1].HTTP.Paths[0].Path)
+	assert.Equal(t, "web-tls", ingress.Spec.TLS[0].SecretName)
+
+	_, err = NewIngressSpec("web").Ingress("default")
+	assert.NotNil(t, err)
+	_, err = NewIngressSpec("web").WithRoute("web.example.com", "/", "", 80).Ingress("default")
+	assert.NotNil(t, err)
+}
+
+func TestExposeService(t *testing.T) {
+	cluster := newFakeCluster()
+	ctx := context.Background()
+
+	_, err := cluster.client.ExposeService(ctx, "default", "web", 80, "web.example.com", "web-tls")
+	assert.Nil(t, err)
+	ingress, err := cluster.clientset.NetworkingV1().Ingresses("default").Get(ctx, "web", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "web.example.com", ingress.Spec.Rules[0].Host)
+	assert.Equal(t, []string{"web.example.com"}, ingress.Spec.TLS[0].Hosts)
+}
+
+func TestApplicationServiceWithIngress(t *testing.T) {
+	ctx := context.Background()
+	legacy := newFakeCluster()
+	for _, list := range legacy.discovery.Resources {
+		if list.GroupVersion == "networking.k8s.io/v1" {
+			list.GroupVersion = "networking.k8s.io/v1beta1"
+		}
+	}
+
+	for version, cluster := range map[string]*fakeCluster{"v1": newFakeCluster(), "v1beta1": legacy} {
+		client := cluster.client
+		err := client.CreateApplicationService(ctx, "default", "web", 1, "web", "nginx:1.25",
+			v1.ServiceTypeClusterIP, "mode", "fast", "db", "10.0.0.5", "postgres", 5432, v1.ProtocolTCP,
+			WithIngress(NewIngressSpec("web-public").WithRoute("web.example.com", "/", "web", 80)))
+		assert.Nil(t, err, version)
+
+		ingresses, err := client.ListIngresses(ctx, "default")
+		assert.Nil(t, err, version)
+		assert.Len(t, ingresses.Items, 1, version)
+		release, err := client.GetRelease(ctx, "default", "web")
+		assert.Nil(t, err, version)
+		assert.Contains(t, release.Objects, ObjectRef{Group: "networking.k8s.io", Version: version, Kind: IngressKind, Namespace: "default", Name: "web-public"}, version)
+
+		assert.Nil(t, client.DeleteApplicationService(ctx, "default", "web", "db"), version)
+		ingresses, err = client.ListIngresses(ctx, "default")
+		assert.Nil(t, err, version)
+		assert.Empty(t, ingresses.Items, version)
+	}
+}
+
+func TestApplicationServiceIngressRollsBack(t *testing.T) {
+	client := newFakeCluster().client
+	ctx := context.Background()
+
+	// an ingress without routes fails after everything else was created
+	err := client.CreateApplicationService(ctx, "default", "web", 1, "web", "nginx:1.25",
+		v1.ServiceTypeClusterIP, "mode", "fast", "db", "10.0.0.5", "postgres", 5432, v1.ProtocolTCP,
+		WithIngress(NewIngressSpec("web")))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Ingress web failed")
+
+	endpoints, _ := client.ListEndpoint(ctx, "default")
+	assert.Empty(t, endpoints.Items)
+	services, _ := client.ListServices(ctx, "default")
+	assert.Empty(t, services.Items)
+}
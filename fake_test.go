@@ -0,0 +1,264 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	ktesting "k8s.io/client-go/testing"
+)
+
+// testResources is what the fake discovery serves.
+var testResources = []*metav1.APIResourceList{
+	{
+		GroupVersion: "v1",
+		APIResources: []metav1.APIResource{
+			{Name: "configmaps", Kind: ConfigMapKind, Namespaced: true, ShortNames: []string{"cm"}},
+			{Name: "endpoints", Kind: "Endpoints", Namespaced: true, ShortNames: []string{"ep"}},
+			{Name: "events", Kind: "Event", Namespaced: true},
+			{Name: "namespaces", Kind: NamespaceKind, ShortNames: []string{"ns"}},
+			{Name: "pods", Kind: PodKind, Namespaced: true, ShortNames: []string{"po"}},
+			{Name: "resourcequotas", Kind: "ResourceQuota", Namespaced: true, ShortNames: []string{"quota"}},
+			{Name: "secrets", Kind: SecretKind, Namespaced: true},
+			{Name: "serviceaccounts", Kind: ServiceAccountKind, Namespaced: true, ShortNames: []string{"sa"}},
+			{Name: "services", Kind: ServiceKind, Namespaced: true, ShortNames: []string{"svc"}},
+		},
+	},
+	{
+		GroupVersion: "apps/v1",
+		APIResources: []metav1.APIResource{
+			{Name: "daemonsets", Kind: DaemonSetKind, Namespaced: true, ShortNames: []string{"ds"}},
+			{Name: "deployments", Kind: DeploymentKind, Namespaced: true, ShortNames: []string{"deploy"}},
+			{Name: "replicasets", Kind: "ReplicaSet", Namespaced: true, ShortNames: []string{"rs"}},
+			{Name: "statefulsets", Kind: StatefulSetKind, Namespaced: true, ShortNames: []string{"sts"}},
+		},
+	},
+	{
+		GroupVersion: "batch/v1",
+		APIResources: []metav1.APIResource{
+			{Name: "jobs", Kind: JobKind, Namespaced: true},
+		},
+	},
+	{
+		GroupVersion: "networking.k8s.io/v1",
+		APIResources: []metav1.APIResource{
+			{Name: "ingressclasses", Kind: IngressClassKind},
+			{Name: "ingresses", Kind: IngressKind, Namespaced: true, ShortNames: []string{"ing"}},
+		},
+	},
+}
+
+// fakeCluster is a KubernetesClient on fake clientsets. Objects created,
+// updated or deleted through the typed clientset show up in the dynamic
+// client and the other way round, so methods mixing both see one cluster.
+type fakeCluster struct {
+	client    *KubernetesClient
+	clientset *fake.Clientset
+	dynamic   *dynamicfake.FakeDynamicClient
+	discovery *fakediscovery.FakeDiscovery
+}
+
+func newFakeCluster(objects ...runtime.Object) *fakeCluster {
+	clientset := fake.NewClientset(objects...)
+	discovery := clientset.Discovery().(*fakediscovery.FakeDiscovery)
+	for _, list := range testResources {
+		discovery.Resources = append(discovery.Resources, list.DeepCopy())
+	}
+
+	listKinds := map[schema.GroupVersionResource]string{}
+	for _, list := range testResources {
+		gv, _ := schema.ParseGroupVersion(list.GroupVersion)
+		for _, resource := range list.APIResources {
+			listKinds[gv.WithResource(resource.Name)] = resource.Kind + "List"
+		}
+	}
+	var unstructuredObjects []runtime.Object
+	for _, obj := range objects {
+		if u, err := toUnstructured(obj); err == nil {
+			unstructuredObjects = append(unstructuredObjects, u)
+		}
+	}
+	dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, unstructuredObjects...)
+
+	mirror := func(from, to ktesting.ObjectTracker, convert func(runtime.Object) (runtime.Object, error)) ktesting.ReactionFunc {
+		react := ktesting.ObjectReaction(from)
+		return func(action ktesting.Action) (bool, runtime.Object, error) {
+			handled, obj, err := react(action)
+			if err != nil {
+				return handled, obj, err
+			}
+			switch a := action.(type) {
+			case ktesting.CreateActionImpl:
+				if converted, err := convert(a.GetObject()); err == nil {
+					to.Create(a.GetResource(), converted, a.GetNamespace())
+				}
+			case ktesting.UpdateActionImpl:
+				if converted, err := convert(a.GetObject()); err == nil {
+					to.Update(a.GetResource(), converted, a.GetNamespace())
+				}
+			case ktesting.DeleteActionImpl:
+				to.Delete(a.GetResource(), a.GetNamespace(), a.GetName())
+			}
+			return handled, obj, err
+		}
+	}
+	for _, verb := range []string{"create", "update", "delete"} {
+		clientset.PrependReactor(verb, "*", mirror(clientset.Tracker(), dyn.Tracker(), toUnstructured))
+		dyn.PrependReactor(verb, "*", mirror(dyn.Tracker(), clientset.Tracker(), toTypedObject))
+	}
+
+	return &fakeCluster{
+		client:    NewKubernetesClientFromInterfaces(clientset, applyingDynamic{dyn}, discovery),
+		clientset: clientset,
+		dynamic:   dyn,
+		discovery: discovery,
+	}
+}
+
+func toUnstructured(obj runtime.Object) (runtime.Object, error) {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return u, nil
+	}
+	gvks, _, err := scheme.Scheme.ObjectKinds(obj)
+	if err != nil {
+		return nil, err
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	u := &unstructured.Unstructured{Object: content}
+	u.SetGroupVersionKind(gvks[0])
+	return u, nil
+}
+
+func toTypedObject(obj runtime.Object) (runtime.Object, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return obj, nil
+	}
+	typed, err := scheme.Scheme.New(u.GroupVersionKind())
+	if err != nil {
+		return nil, err
+	}
+	return typed, runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, typed)
+}
+
+// applyingDynamic emulates server-side apply and dry runs, the fake dynamic
+// client only applies to existing objects and ignores DryRun.
+type applyingDynamic struct {
+	*dynamicfake.FakeDynamicClient
+}
+
+func (d applyingDynamic) Resource(resource schema.GroupVersionResource) dynamic.NamespaceableResourceInterface {
+	return applyingNamespaceableResource{d.FakeDynamicClient.Resource(resource)}
+}
+
+type applyingNamespaceableResource struct {
+	dynamic.NamespaceableResourceInterface
+}
+
+func (r applyingNamespaceableResource) Namespace(namespace string) dynamic.ResourceInterface {
+	return applyingResource{r.NamespaceableResourceInterface.Namespace(namespace)}
+}
+
+func (r applyingNamespaceableResource) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	return applyingResource{r.NamespaceableResourceInterface}.Patch(ctx, name, pt, data, opts, subresources...)
+}
+
+func (r applyingNamespaceableResource) Delete(ctx context.Context, name string, opts metav1.DeleteOptions, subresources ...string) error {
+	return applyingResource{r.NamespaceableResourceInterface}.Delete(ctx, name, opts, subresources...)
+}
+
+func (r applyingNamespaceableResource) List(ctx context.Context, opts metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	return applyingResource{r.NamespaceableResourceInterface}.List(ctx, opts)
+}
+
+type applyingResource struct {
+	dynamic.ResourceInterface
+}
+
+func (r applyingResource) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	if pt != types.ApplyPatchType {
+		return r.ResourceInterface.Patch(ctx, name, pt, data, opts, subresources...)
+	}
+	applied := &unstructured.Unstructured{}
+	if err := json.Unmarshal(data, &applied.Object); err != nil {
+		return nil, err
+	}
+
+	live, err := r.Get(ctx, name, metav1.GetOptions{})
+	if err != nil && !IsNotFound(err) {
+		return nil, err
+	}
+	exists := err == nil
+	if exists {
+		mergeInto(live.Object, applied.Object)
+		applied = live
+	}
+	if len(opts.DryRun) > 0 {
+		return applied, nil
+	}
+	if exists {
+		return r.Update(ctx, applied, metav1.UpdateOptions{})
+	}
+	return r.Create(ctx, applied, metav1.CreateOptions{})
+}
+
+func (r applyingResource) Delete(ctx context.Context, name string, opts metav1.DeleteOptions, subresources ...string) error {
+	if len(opts.DryRun) > 0 {
+		_, err := r.Get(ctx, name, metav1.GetOptions{})
+		return err
+	}
+	return r.ResourceInterface.Delete(ctx, name, opts, subresources...)
+}
+
+// List pages by Limit and Continue, which the fake dynamic client ignores.
+func (r applyingResource) List(ctx context.Context, opts metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	list, err := r.ResourceInterface.List(ctx, opts)
+	if err != nil || opts.Limit == 0 {
+		return list, err
+	}
+	sort.Slice(list.Items, func(i, j int) bool {
+		return list.Items[i].GetNamespace()+"/"+list.Items[i].GetName() < list.Items[j].GetNamespace()+"/"+list.Items[j].GetName()
+	})
+	start := 0
+	if opts.Continue != "" {
+		if start, err = strconv.Atoi(opts.Continue); err != nil {
+			return nil, apierrors.NewBadRequest("invalid continue token")
+		}
+	}
+	end := start + int(opts.Limit)
+	if end < len(list.Items) {
+		list.SetContinue(strconv.Itoa(end))
+	} else {
+		end = len(list.Items)
+	}
+	list.Items = list.Items[start:end]
+	return list, nil
+}
+
+// mergeInto merges maps recursively, any other value of patch replaces the one in obj.
+func mergeInto(obj map[string]interface{}, patch map[string]interface{}) {
+	for k, v := range patch {
+		patchMap, ok := v.(map[string]interface{})
+		objMap, isMap := obj[k].(map[string]interface{})
+		if ok && isMap {
+			mergeInto(objMap, patchMap)
+			continue
+		}
+		obj[k] = v
+	}
+}
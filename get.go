@@ -0,0 +1,87 @@
+package kubernetes
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// GetByGVK reads one object of any kind the cluster serves, CRD instances
+// included. Namespaced kinds default to the "default" namespace.
+func (c *KubernetesClient) GetByGVK(ctx context.Context, gvk schema.GroupVersionKind, namespace string, name string) (*unstructured.Unstructured, error) {
+	mapping, err := c.restMapping(gvk)
+	if err != nil {
+		return nil, objectError("get", gvk, namespace, name, err)
+	}
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace && namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	obj, err := c.resourceInterface(mapping, namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, objectError("get", gvk, namespace, name, err)
+	}
+	return obj, nil
+}
+
+// ListByGVK lists gvk in namespace, "" lists all namespaces.
+func (c *KubernetesClient) ListByGVK(ctx context.Context, gvk schema.GroupVersionKind, namespace string, opts ...ListOptions) (*unstructured.UnstructuredList, error) {
+	mapping, err := c.restMapping(gvk)
+	if err != nil {
+		return nil, objectError("list", gvk, namespace, "", err)
+	}
+	list, err := c.resourceInterface(mapping, namespace).List(ctx, listOptions(opts))
+	if err != nil {
+		return nil, objectError("list", gvk, namespace, "", err)
+	}
+	return list, nil
+}
+
+// GetByKind is GetByGVK for a kind as kubectl takes it: "deploy", "svc",
+// "deployments.apps", "ServiceMonitor", ...
+func (c *KubernetesClient) GetByKind(ctx context.Context, kind string, namespace string, name string) (*unstructured.Unstructured, error) {
+	gvk, err := c.kindFor(kind)
+	if err != nil {
+		return nil, objectError("get", schema.GroupVersionKind{Kind: kind}, namespace, name, err)
+	}
+	return c.GetByGVK(ctx, gvk, namespace, name)
+}
+
+func (c *KubernetesClient) ListByKind(ctx context.Context, kind string, namespace string, opts ...ListOptions) (*unstructured.UnstructuredList, error) {
+	gvk, err := c.kindFor(kind)
+	if err != nil {
+		return nil, objectError("list", schema.GroupVersionKind{Kind: kind}, namespace, "", err)
+	}
+	return c.ListByGVK(ctx, gvk, namespace, opts...)
+}
+
+// GetDynamicUnstructured reads the object a YAML stub names by apiVersion,
+// kind, metadata.namespace and metadata.name.
+func (c *KubernetesClient) GetDynamicUnstructured(ctx context.Context, yaml string) (*unstructured.Unstructured, error) {
+	obj, err := decodeObject(yaml)
+	if err != nil {
+		return nil, err
+	}
+	return c.GetByGVK(ctx, obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName())
+}
+
+// ListDynamicUnstructured lists the kind of a YAML stub in its namespace, like EventsDynamicUnstructured watches it.
+func (c *KubernetesClient) ListDynamicUnstructured(ctx context.Context, yaml string, opts ...ListOptions) (*unstructured.UnstructuredList, error) {
+	obj, err := decodeObject(yaml)
+	if err != nil {
+		return nil, err
+	}
+	return c.ListByGVK(ctx, obj.GroupVersionKind(), obj.GetNamespace(), opts...)
+}
+
+// DecodeUnstructured converts an object or list returned by the Get and List
+// methods into a typed struct, e.g. *appsv1.Deployment or a CRD's Go type.
+func DecodeUnstructured(obj runtime.Unstructured, into interface{}) error {
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.UnstructuredContent(), into); err != nil {
+		return decodeError(err)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestGetByKind(t *testing.T) {
+	replicas := int32(3)
+	client := newFakeCluster(
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}, Spec: appsv1.DeploymentSpec{Replicas: &replicas}},
+		&v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}},
+		&v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "data"}},
+	).client
+	ctx := context.Background()
+
+	for _, kind := range []string{"deploy", "deployments", "deployments.apps", "deployments.v1.apps", "Deployment", "deployment"} {
+		obj, err := client.GetByKind(ctx, kind, "", "web")
+		assert.Nil(t, err, kind)
+		assert.Equal(t, "web", obj.GetName(), kind)
+	}
+
+	services, err := client.ListByKind(ctx, "svc", "")
+	assert.Nil(t, err)
+	assert.Len(t, services.Items, 2)
+
+	_, err = client.GetByKind(ctx, "nosuchkind", "default", "web")
+	assert.NotNil(t, err)
+	_, err = client.GetByKind(ctx, "svc", "default", "missing")
+	assert.True(t, IsNotFound(err))
+}
+
+func TestGetDynamicUnstructuredDecode(t *testing.T) {
+	replicas := int32(3)
+	client := newFakeCluster(
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}, Spec: appsv1.DeploymentSpec{Replicas: &replicas}},
+	).client
+	ctx := context.Background()
+
+	obj, err := client.GetDynamicUnstructured(ctx, fakeDeploymentYAML)
+	assert.Nil(t, err)
+	deployment := &appsv1.Deployment{}
+	assert.Nil(t, DecodeUnstructured(obj, deployment))
+	assert.Equal(t, int32(3), *deployment.Spec.Replicas)
+
+	list, err := client.ListDynamicUnstructured(ctx, fakeDeploymentYAML)
+	assert.Nil(t, err)
+	deployments := &appsv1.DeploymentList{}
+	assert.Nil(t, DecodeUnstructured(list, deployments))
+	assert.Len(t, deployments.Items, 1)
+}
+
+func TestGetByKindCustomResource(t *testing.T) {
+	cluster := newFakeCluster()
+	ctx := context.Background()
+	monitors := schema.GroupVersionResource{Group: "monitoring.coreos.com", Version: "v1", Resource: "servicemonitors"}
+	monitor := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "monitoring.coreos.com/v1",
+		"kind":       ServiceMonitorKind,
+		"metadata":   map[string]interface{}{"name": "redis", "namespace": "default"},
+	}}
+	assert.Nil(t, cluster.dynamic.Tracker().Create(monitors, monitor, "default"))
+
+	_, err := cluster.client.GetByKind(ctx, "smon", "default", "redis")
+	assert.NotNil(t, err)
+
+	// CRD installed after the cache was filled
+	cluster.discovery.Resources = append(cluster.discovery.Resources, &metav1.APIResourceList{
+		GroupVersion: "monitoring.coreos.com/v1",
+		APIResources: []metav1.APIResource{{Name: "servicemonitors", Kind: ServiceMonitorKind, Namespaced: true, ShortNames: []string{"smon"}}},
+	})
+	obj, err := cluster.client.GetByKind(ctx, "smon", "default", "redis")
+	assert.Nil(t, err)
+	assert.Equal(t, "redis", obj.GetName())
+	obj, err = cluster.client.GetByKind(ctx, ServiceMonitorKind, "default", "redis")
+	assert.Nil(t, err)
+	assert.Equal(t, "redis", obj.GetName())
+}
@@ -0,0 +1,244 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+
+	netv1 "k8s.io/api/networking/v1"
+	netv1beta1 "k8s.io/api/networking/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	IngressClassKind = "IngressClass"
+
+	// DefaultIngressClassAnnotation marks the IngressClass used by Ingresses without a class.
+	DefaultIngressClassAnnotation = "ingressclass.kubernetes.io/is-default-class"
+)
+
+// ingressVersion returns the newest Ingress version the server serves,
+// networking.k8s.io/v1 from Kubernetes 1.19, v1beta1 before.
+func (c *KubernetesClient) ingressVersion() (string, error) {
+	ingress := schema.GroupKind{Group: netv1.GroupName, Kind: IngressKind}
+	mapping, err := c.mapper.RESTMapping(ingress, netv1.SchemeGroupVersion.Version, netv1beta1.SchemeGroupVersion.Version)
+	if err != nil {
+		c.mapper.Reset()
+		mapping, err = c.mapper.RESTMapping(ingress, netv1.SchemeGroupVersion.Version, netv1beta1.SchemeGroupVersion.Version)
+	}
+	if err != nil {
+		return "", objectError("discover", netv1.SchemeGroupVersion.WithKind(IngressKind), "", "", err)
+	}
+	return mapping.GroupVersionKind.Version, nil
+}
+
+// ListIngresses returns networking.k8s.io/v1 Ingresses, on servers without v1
+// the v1beta1 ones are listed and converted.
+func (c *KubernetesClient) ListIngresses(ctx context.Context, namespace string, opts ...ListOptions) (*netv1.IngressList, error) {
+	version, err := c.ingressVersion()
+	if err != nil {
+		return nil, err
+	}
+	if version == netv1.SchemeGroupVersion.Version {
+		return c.clientset.NetworkingV1().Ingresses(namespace).List(ctx, listOptions(opts))
+	}
+
+	legacy, err := c.clientset.NetworkingV1beta1().Ingresses(namespace).List(ctx, listOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+	list := &netv1.IngressList{ListMeta: legacy.ListMeta}
+	for i := range legacy.Items {
+		list.Items = append(list.Items, *IngressFromV1beta1(&legacy.Items[i]))
+	}
+	return list, nil
+}
+
+// CreateIngress creates ingress in its namespace, converted to v1beta1 when the server has no v1.
+func (c *KubernetesClient) CreateIngress(ctx context.Context, ingress *netv1.Ingress) (*netv1.Ingress, error) {
+	gvk := netv1.SchemeGroupVersion.WithKind(IngressKind)
+	version, err := c.ingressVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	var result *netv1.Ingress
+	if version == netv1.SchemeGroupVersion.Version {
+		result, err = c.clientset.NetworkingV1().Ingresses(ingress.Namespace).Create(ctx, ingress, metav1.CreateOptions{})
+	} else {
+		var legacy *netv1beta1.Ingress
+		legacy, err = c.clientset.NetworkingV1beta1().Ingresses(ingress.Namespace).Create(ctx, IngressToV1beta1(ingress), metav1.CreateOptions{})
+		if err == nil {
+			result = IngressFromV1beta1(legacy)
+		}
+	}
+	if err != nil {
+		return nil, objectError("create", gvk, ingress.Namespace, ingress.Name, err)
+	}
+	fmt.Printf("Created ingress %s\n", result.Name)
+	return result, nil
+}
+
+func (c *KubernetesClient) DeleteIngress(ctx context.Context, namespace string, name string) error {
+	version, err := c.ingressVersion()
+	if err != nil {
+		return err
+	}
+	if version == netv1.SchemeGroupVersion.Version {
+		err = c.clientset.NetworkingV1().Ingresses(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	} else {
+		err = c.clientset.NetworkingV1beta1().Ingresses(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	}
+	return objectError("delete", netv1.SchemeGroupVersion.WithKind(IngressKind), namespace, name, err)
+}
+
+func (c *KubernetesClient) ListIngressClasses(ctx context.Context, opts ...ListOptions) (*netv1.IngressClassList, error) {
+	return c.clientset.NetworkingV1().IngressClasses().List(ctx, listOptions(opts))
+}
+
+// CreateIngressClass registers controller, e.g. "k8s.io/ingress-nginx", as
+// class name. A default class is used by Ingresses that name no class.
+func (c *KubernetesClient) CreateIngressClass(ctx context.Context, name string, controller string, isDefault bool) (*netv1.IngressClass, error) {
+	class := &netv1.IngressClass{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       netv1.IngressClassSpec{Controller: controller},
+	}
+	if isDefault {
+		class.Annotations = map[string]string{DefaultIngressClassAnnotation: "true"}
+	}
+	result, err := c.clientset.NetworkingV1().IngressClasses().Create(ctx, class, metav1.CreateOptions{})
+	if err != nil {
+		return nil, objectError("create", netv1.SchemeGroupVersion.WithKind(IngressClassKind), "", name, err)
+	}
+	fmt.Printf("Created ingress class %s\n", result.Name)
+	return result, nil
+}
+
+func (c *KubernetesClient) DeleteIngressClass(ctx context.Context, name string) error {
+	err := c.clientset.NetworkingV1().IngressClasses().Delete(ctx, name, metav1.DeleteOptions{})
+	return objectError("delete", netv1.SchemeGroupVersion.WithKind(IngressClassKind), "", name, err)
+}
+
+// DefaultIngressClass returns the class marked as default, nil when there is none.
+func (c *KubernetesClient) DefaultIngressClass(ctx context.Context) (*netv1.IngressClass, error) {
+	classes, err := c.ListIngressClasses(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range classes.Items {
+		if classes.Items[i].Annotations[DefaultIngressClassAnnotation] == "true" {
+			return &classes.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// IngressFromV1beta1 converts a networking.k8s.io/v1beta1 Ingress to v1.
+func IngressFromV1beta1(in *netv1beta1.Ingress) *netv1.Ingress {
+	out := &netv1.Ingress{
+		TypeMeta:   metav1.TypeMeta{APIVersion: netv1.SchemeGroupVersion.String(), Kind: IngressKind},
+		ObjectMeta: *in.ObjectMeta.DeepCopy(),
+		Spec: netv1.IngressSpec{
+			IngressClassName: in.Spec.IngressClassName,
+			DefaultBackend:   backendFromV1beta1(in.Spec.Backend),
+		},
+	}
+	for _, tls := range in.Spec.TLS {
+		out.Spec.TLS = append(out.Spec.TLS, netv1.IngressTLS{Hosts: tls.Hosts, SecretName: tls.SecretName})
+	}
+	for _, rule := range in.Spec.Rules {
+		outRule := netv1.IngressRule{Host: rule.Host}
+		if rule.HTTP != nil {
+			outRule.HTTP = &netv1.HTTPIngressRuleValue{}
+			for _, path := range rule.HTTP.Paths {
+				outPath := netv1.HTTPIngressPath{Path: path.Path, Backend: *backendFromV1beta1(&path.Backend)}
+				if path.PathType != nil {
+					pathType := netv1.PathType(*path.PathType)
+					outPath.PathType = &pathType
+				}
+				outRule.HTTP.Paths = append(outRule.HTTP.Paths, outPath)
+			}
+		}
+		out.Spec.Rules = append(out.Spec.Rules, outRule)
+	}
+	for _, lb := range in.Status.LoadBalancer.Ingress {
+		outLB := netv1.IngressLoadBalancerIngress{IP: lb.IP, Hostname: lb.Hostname}
+		for _, port := range lb.Ports {
+			outLB.Ports = append(outLB.Ports, netv1.IngressPortStatus{Port: port.Port, Protocol: port.Protocol, Error: port.Error})
+		}
+		out.Status.LoadBalancer.Ingress = append(out.Status.LoadBalancer.Ingress, outLB)
+	}
+	return out
+}
+
+// IngressToV1beta1 converts a v1 Ingress for servers older than Kubernetes 1.19.
+func IngressToV1beta1(in *netv1.Ingress) *netv1beta1.Ingress {
+	out := &netv1beta1.Ingress{
+		TypeMeta:   metav1.TypeMeta{APIVersion: netv1beta1.SchemeGroupVersion.String(), Kind: IngressKind},
+		ObjectMeta: *in.ObjectMeta.DeepCopy(),
+		Spec: netv1beta1.IngressSpec{
+			IngressClassName: in.Spec.IngressClassName,
+			Backend:          backendToV1beta1(in.Spec.DefaultBackend),
+		},
+	}
+	for _, tls := range in.Spec.TLS {
+		out.Spec.TLS = append(out.Spec.TLS, netv1beta1.IngressTLS{Hosts: tls.Hosts, SecretName: tls.SecretName})
+	}
+	for _, rule := range in.Spec.Rules {
+		outRule := netv1beta1.IngressRule{Host: rule.Host}
+		if rule.HTTP != nil {
+			outRule.HTTP = &netv1beta1.HTTPIngressRuleValue{}
+			for _, path := range rule.HTTP.Paths {
+				outPath := netv1beta1.HTTPIngressPath{Path: path.Path, Backend: *backendToV1beta1(&path.Backend)}
+				if path.PathType != nil {
+					pathType := netv1beta1.PathType(*path.PathType)
+					outPath.PathType = &pathType
+				}
+				outRule.HTTP.Paths = append(outRule.HTTP.Paths, outPath)
+			}
+		}
+		out.Spec.Rules = append(out.Spec.Rules, outRule)
+	}
+	for _, lb := range in.Status.LoadBalancer.Ingress {
+		outLB := netv1beta1.IngressLoadBalancerIngress{IP: lb.IP, Hostname: lb.Hostname}
+		for _, port := range lb.Ports {
+			outLB.Ports = append(outLB.Ports, netv1beta1.IngressPortStatus{Port: port.Port, Protocol: port.Protocol, Error: port.Error})
+		}
+		out.Status.LoadBalancer.Ingress = append(out.Status.LoadBalancer.Ingress, outLB)
+	}
+	return out
+}
+
+// v1beta1 has serviceName/servicePort, v1 a service with a port name or number.
+func backendFromV1beta1(in *netv1beta1.IngressBackend) *netv1.IngressBackend {
+	if in == nil {
+		return nil
+	}
+	out := &netv1.IngressBackend{Resource: in.Resource}
+	if in.ServiceName != "" {
+		out.Service = &netv1.IngressServiceBackend{Name: in.ServiceName}
+		if in.ServicePort.Type == intstr.String {
+			out.Service.Port.Name = in.ServicePort.StrVal
+		} else {
+			out.Service.Port.Number = in.ServicePort.IntVal
+		}
+	}
+	return out
+}
+
+func backendToV1beta1(in *netv1.IngressBackend) *netv1beta1.IngressBackend {
+	if in == nil {
+		return nil
+	}
+	out := &netv1beta1.IngressBackend{Resource: in.Resource}
+	if in.Service != nil {
+		out.ServiceName = in.Service.Name
+		if in.Service.Port.Name != "" {
+			out.ServicePort = intstr.FromString(in.Service.Port.Name)
+		} else {
+			out.ServicePort = intstr.FromInt32(in.Service.Port.Number)
+		}
+	}
+	return out
+}
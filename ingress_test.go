@@ -0,0 +1,106 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	netv1 "k8s.io/api/networking/v1"
+	netv1beta1 "k8s.io/api/networking/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func testIngress() *netv1.Ingress {
+	class := "nginx"
+	prefix := netv1.PathTypePrefix
+	return &netv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec: netv1.IngressSpec{
+			IngressClassName: &class,
+			DefaultBackend:   &netv1.IngressBackend{Service: &netv1.IngressServiceBackend{Name: "fallback", Port: netv1.ServiceBackendPort{Name: "http"}}},
+			TLS:              []netv1.IngressTLS{{Hosts: []string{"web.example.com"}, SecretName: "web-tls"}},
+			Rules: []netv1.IngressRule{{
+				Host: "web.example.com",
+				IngressRuleValue: netv1.IngressRuleValue{HTTP: &netv1.HTTPIngressRuleValue{Paths: []netv1.HTTPIngressPath{{
+					Path:     "/",
+					PathType: &prefix,
+					Backend:  netv1.IngressBackend{Service: &netv1.IngressServiceBackend{Name: "web", Port: netv1.ServiceBackendPort{Number: 80}}},
+				}}}},
+			}},
+		},
+		Status: netv1.IngressStatus{LoadBalancer: netv1.IngressLoadBalancerStatus{Ingress: []netv1.IngressLoadBalancerIngress{{IP: "10.0.0.1"}}}},
+	}
+}
+
+func TestIngressConversion(t *testing.T) {
+	ingress := testIngress()
+
+	legacy := IngressToV1beta1(ingress)
+	assert.Equal(t, "networking.k8s.io/v1beta1", legacy.APIVersion)
+	assert.Equal(t, "fallback", legacy.Spec.Backend.ServiceName)
+	assert.Equal(t, intstr.FromString("http"), legacy.Spec.Backend.ServicePort)
+	backend := legacy.Spec.Rules[0].HTTP.Paths[0].Backend
+	assert.Equal(t, "web", backend.ServiceName)
+	assert.Equal(t, intstr.FromInt32(80), backend.ServicePort)
+	assert.Equal(t, netv1beta1.PathTypePrefix, *legacy.Spec.Rules[0].HTTP.Paths[0].PathType)
+
+	back := IngressFromV1beta1(legacy)
+	ingress.TypeMeta = back.TypeMeta
+	assert.Equal(t, ingress, back)
+}
+
+func TestIngressVersionNegotiation(t *testing.T) {
+	ctx := context.Background()
+
+	cluster := newFakeCluster()
+	_, err := cluster.client.CreateIngress(ctx, testIngress())
+	assert.Nil(t, err)
+	_, err = cluster.clientset.NetworkingV1().Ingresses("default").Get(ctx, "web", metav1.GetOptions{})
+	assert.Nil(t, err)
+	ingresses, err := cluster.client.ListIngresses(ctx, "default")
+	assert.Nil(t, err)
+	assert.Len(t, ingresses.Items, 1)
+
+	// a server older than 1.19 only serves v1beta1
+	legacy := newFakeCluster()
+	for _, list := range legacy.discovery.Resources {
+		if list.GroupVersion == "networking.k8s.io/v1" {
+			list.GroupVersion = "networking.k8s.io/v1beta1"
+		}
+	}
+	_, err = legacy.client.CreateIngress(ctx, testIngress())
+	assert.Nil(t, err)
+	created, err := legacy.clientset.NetworkingV1beta1().Ingresses("default").Get(ctx, "web", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "web", created.Spec.Rules[0].HTTP.Paths[0].Backend.ServiceName)
+	ingresses, err = legacy.client.ListIngresses(ctx, "default")
+	assert.Nil(t, err)
+	assert.Len(t, ingresses.Items, 1)
+	assert.Equal(t, int32(80), ingresses.Items[0].Spec.Rules[0].HTTP.Paths[0].Backend.Service.Port.Number)
+
+	assert.Nil(t, legacy.client.DeleteIngress(ctx, "default", "web"))
+	assert.True(t, IsNotFound(legacy.client.DeleteIngress(ctx, "default", "web")))
+}
+
+func TestIngressClasses(t *testing.T) {
+	client := newFakeCluster().client
+	ctx := context.Background()
+
+	_, err := client.CreateIngressClass(ctx, "internal", "k8s.io/ingress-nginx", false)
+	assert.Nil(t, err)
+	class, err := client.DefaultIngressClass(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, class)
+
+	_, err = client.CreateIngressClass(ctx, "nginx", "k8s.io/ingress-nginx", true)
+	assert.Nil(t, err)
+	class, err = client.DefaultIngressClass(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "nginx", class.Name)
+
+	classes, err := client.ListIngressClasses(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, classes.Items, 2)
+	assert.Nil(t, client.DeleteIngressClass(ctx, "internal"))
+}
@@ -3,35 +3,82 @@ package kubernetes
 type Kind = string
 
 const (
-	ConfigMapKind          = "ConfigMap"
-	ClusterRoleKind        = "ClusterRole"
-	ClusterRoleBindingKind = "ClusterRoleBinding"
-	DeploymentKind         = "Deployment"
-	IngressKind            = "Ingress"
-	JobKind                = "Job"
-	NamespaceKind          = "Namespace"
-	PodKind                = "Pod"
-	RoleKind               = "Role"        // Not currently used
-	RoleBindingKind        = "RoleBinding" // Not currently used
-	SecretKind             = "Secret"
-	ServiceKind            = "Service"
-	ServiceMonitorKind     = "ServiceMonitor"
-	StatefulSetKind        = "StatefulSet"
+	ConfigMapKind                = "ConfigMap"
+	ClusterRoleKind              = "ClusterRole"
+	ClusterRoleBindingKind       = "ClusterRoleBinding"
+	CustomResourceDefinitionKind = "CustomResourceDefinition"
+	DaemonSetKind                = "DaemonSet"
+	DeploymentKind               = "Deployment"
+	IngressKind                  = "Ingress"
+	JobKind                      = "Job"
+	NamespaceKind                = "Namespace"
+	PodKind                      = "Pod"
+	RoleKind                     = "Role"        // Not currently used
+	RoleBindingKind              = "RoleBinding" // Not currently used
+	SecretKind                   = "Secret"
+	ServiceKind                  = "Service"
+	ServiceAccountKind           = "ServiceAccount"
+	ServiceMonitorKind           = "ServiceMonitor"
+	StatefulSetKind              = "StatefulSet"
 )
 
 var Kinds = map[Kind]struct{}{
-	ConfigMapKind:          {},
-	ClusterRoleKind:        {},
-	ClusterRoleBindingKind: {},
-	DeploymentKind:         {},
-	IngressKind:            {},
-	JobKind:                {},
-	NamespaceKind:          {},
-	PodKind:                {},
-	RoleKind:               {},
-	RoleBindingKind:        {},
-	SecretKind:             {},
-	ServiceKind:            {},
-	ServiceMonitorKind:     {},
-	StatefulSetKind:        {},
+	ConfigMapKind:                {},
+	ClusterRoleKind:              {},
+	ClusterRoleBindingKind:       {},
+	CustomResourceDefinitionKind: {},
+	DaemonSetKind:                {},
+	DeploymentKind:               {},
+	IngressKind:                  {},
+	JobKind:                      {},
+	NamespaceKind:                {},
+	PodKind:                      {},
+	RoleKind:                     {},
+	RoleBindingKind:              {},
+	SecretKind:                   {},
+	ServiceKind:                  {},
+	ServiceAccountKind:           {},
+	ServiceMonitorKind:           {},
+	StatefulSetKind:              {},
+}
+
+// InstallOrder is the order in which kinds are applied from a manifest
+// stream. Kinds that are not listed are applied last, in stream order.
+var InstallOrder = []Kind{
+	NamespaceKind,
+	"NetworkPolicy",
+	"ResourceQuota",
+	"LimitRange",
+	CustomResourceDefinitionKind,
+	ServiceAccountKind,
+	SecretKind,
+	ConfigMapKind,
+	"StorageClass",
+	"PersistentVolume",
+	"PersistentVolumeClaim",
+	ClusterRoleKind,
+	ClusterRoleBindingKind,
+	RoleKind,
+	RoleBindingKind,
+	ServiceKind,
+	"Endpoints",
+	DaemonSetKind,
+	PodKind,
+	"ReplicaSet",
+	DeploymentKind,
+	"HorizontalPodAutoscaler",
+	StatefulSetKind,
+	JobKind,
+	"CronJob",
+	IngressKind,
+	ServiceMonitorKind,
+}
+
+func installOrderIndex(kind Kind) int {
+	for i, k := range InstallOrder {
+		if k == kind {
+			return i
+		}
+	}
+	return len(InstallOrder)
 }
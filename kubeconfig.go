@@ -1,27 +1,242 @@
 package kubernetes
 
+import (
+	"encoding/json"
+	"fmt"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// KubeConfig is a kubeconfig file as kubectl writes it. Every field kubectl
+// knows is modelled, extensions are kept as raw JSON, so a file survives a
+// round trip through the struct.
 type KubeConfig struct {
-	ApiVersion     string `json:"apiVersion,omitempty"`
-	Kind           string `json:"kind,omitempty"`
-	CurrentContext string `json:"current-context,omitempty"`
-	Clusters       []struct {
-		Name    string `json:"name,omitempty"`
-		Cluster struct {
-			Server                   string `json:"server,omitempty"`
-			CertificateAuthorityData string `json:"certificate-authority-data,omitempty"`
-		} `json:"cluster,omitempty"`
-	} `json:"clusters,omitempty"`
-	Users []struct {
-		Name string `json:"name,omitempty"`
-		User struct {
-			Token string `json:"token,omitempty"`
-		} `json:"user,omitempty"`
-	} `json:"users,omitempty"`
-	Contexts []struct {
-		Name    string `json:"name,omitempty"`
-		Context struct {
-			User    string `json:"user,omitempty"`
-			Cluster string `json:"cluster,omitempty"`
-		} `json:"context,omitempty"`
-	} `json:"contexts,omitempty"`
+	ApiVersion     string             `json:"apiVersion,omitempty"`
+	Kind           string             `json:"kind,omitempty"`
+	Preferences    *KubePreferences   `json:"preferences,omitempty"`
+	CurrentContext string             `json:"current-context,omitempty"`
+	Clusters       []KubeNamedCluster `json:"clusters,omitempty"`
+	Users          []KubeNamedUser    `json:"users,omitempty"`
+	Contexts       []KubeNamedContext `json:"contexts,omitempty"`
+	Extensions     []KubeExtension    `json:"extensions,omitempty"`
+}
+
+type KubePreferences struct {
+	Colors     bool            `json:"colors,omitempty"`
+	Extensions []KubeExtension `json:"extensions,omitempty"`
+}
+
+type KubeNamedCluster struct {
+	Name    string      `json:"name"`
+	Cluster KubeCluster `json:"cluster"`
+}
+
+type KubeCluster struct {
+	Server                   string          `json:"server,omitempty"`
+	TLSServerName            string          `json:"tls-server-name,omitempty"`
+	InsecureSkipTLSVerify    bool            `json:"insecure-skip-tls-verify,omitempty"`
+	CertificateAuthority     string          `json:"certificate-authority,omitempty"`
+	CertificateAuthorityData string          `json:"certificate-authority-data,omitempty"`
+	ProxyURL                 string          `json:"proxy-url,omitempty"`
+	DisableCompression       bool            `json:"disable-compression,omitempty"`
+	Extensions               []KubeExtension `json:"extensions,omitempty"`
+}
+
+type KubeNamedUser struct {
+	Name string   `json:"name"`
+	User KubeUser `json:"user"`
+}
+
+// KubeUser holds the credentials of a user, kubectl calls it AuthInfo.
+type KubeUser struct {
+	ClientCertificate     string              `json:"client-certificate,omitempty"`
+	ClientCertificateData string              `json:"client-certificate-data,omitempty"`
+	ClientKey             string              `json:"client-key,omitempty"`
+	ClientKeyData         string              `json:"client-key-data,omitempty"`
+	Token                 string              `json:"token,omitempty"`
+	TokenFile             string              `json:"tokenFile,omitempty"`
+	Impersonate           string              `json:"as,omitempty"`
+	ImpersonateUID        string              `json:"as-uid,omitempty"`
+	ImpersonateGroups     []string            `json:"as-groups,omitempty"`
+	ImpersonateUserExtra  map[string][]string `json:"as-user-extra,omitempty"`
+	Username              string              `json:"username,omitempty"`
+	Password              string              `json:"password,omitempty"`
+	AuthProvider          *KubeAuthProvider   `json:"auth-provider,omitempty"`
+	Exec                  *KubeExec           `json:"exec,omitempty"`
+	Extensions            []KubeExtension     `json:"extensions,omitempty"`
+}
+
+// KubeAuthProvider is the legacy auth plugin config, e.g. gcp or oidc.
+type KubeAuthProvider struct {
+	Name   string            `json:"name"`
+	Config map[string]string `json:"config,omitempty"`
+}
+
+// KubeExec runs a credential plugin, e.g. aws eks get-token or gke-gcloud-auth-plugin.
+type KubeExec struct {
+	Command            string        `json:"command"`
+	Args               []string      `json:"args,omitempty"`
+	Env                []KubeExecEnv `json:"env,omitempty"`
+	APIVersion         string        `json:"apiVersion,omitempty"`
+	InstallHint        string        `json:"installHint,omitempty"`
+	ProvideClusterInfo bool          `json:"provideClusterInfo,omitempty"`
+	InteractiveMode    string        `json:"interactiveMode,omitempty"`
+}
+
+type KubeExecEnv struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type KubeNamedContext struct {
+	Name    string      `json:"name"`
+	Context KubeContext `json:"context"`
+}
+
+type KubeContext struct {
+	Cluster    string          `json:"cluster,omitempty"`
+	User       string          `json:"user,omitempty"`
+	Namespace  string          `json:"namespace,omitempty"`
+	Extensions []KubeExtension `json:"extensions,omitempty"`
+}
+
+type KubeExtension struct {
+	Name      string          `json:"name"`
+	Extension json.RawMessage `json:"extension"`
+}
+
+// ParseKubeConfig reads a kubeconfig in YAML or JSON.
+func ParseKubeConfig(data []byte) (*KubeConfig, error) {
+	config := &KubeConfig{}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, decodeError(fmt.Errorf("kubeconfig: %v", err))
+	}
+	return config, nil
+}
+
+func (c *KubeConfig) Cluster(name string) (*KubeCluster, bool) {
+	for i := range c.Clusters {
+		if c.Clusters[i].Name == name {
+			return &c.Clusters[i].Cluster, true
+		}
+	}
+	return nil, false
+}
+
+func (c *KubeConfig) User(name string) (*KubeUser, bool) {
+	for i := range c.Users {
+		if c.Users[i].Name == name {
+			return &c.Users[i].User, true
+		}
+	}
+	return nil, false
+}
+
+func (c *KubeConfig) Context(name string) (*KubeContext, bool) {
+	for i := range c.Contexts {
+		if c.Contexts[i].Name == name {
+			return &c.Contexts[i].Context, true
+		}
+	}
+	return nil, false
+}
+
+// Validate reports duplicate or empty names and references to clusters,
+// users and contexts that are not defined.
+func (c *KubeConfig) Validate() error {
+	var errs []error
+	checkNames := func(section string, names []string) {
+		seen := map[string]bool{}
+		for _, name := range names {
+			if name == "" {
+				errs = append(errs, fmt.Errorf("%s: entry without a name", section))
+			} else if seen[name] {
+				errs = append(errs, fmt.Errorf("%s: %q is defined more than once", section, name))
+			}
+			seen[name] = true
+		}
+	}
+
+	var names []string
+	for _, cluster := range c.Clusters {
+		names = append(names, cluster.Name)
+		if cluster.Cluster.Server == "" {
+			errs = append(errs, fmt.Errorf("cluster %q has no server", cluster.Name))
+		}
+	}
+	checkNames("clusters", names)
+
+	names = nil
+	for _, user := range c.Users {
+		names = append(names, user.Name)
+	}
+	checkNames("users", names)
+
+	names = nil
+	for _, context := range c.Contexts {
+		names = append(names, context.Name)
+		if _, ok := c.Cluster(context.Context.Cluster); !ok {
+			errs = append(errs, fmt.Errorf("context %q references unknown cluster %q", context.Name, context.Context.Cluster))
+		}
+		if context.Context.User != "" {
+			if _, ok := c.User(context.Context.User); !ok {
+				errs = append(errs, fmt.Errorf("context %q references unknown user %q", context.Name, context.Context.User))
+			}
+		}
+	}
+	checkNames("contexts", names)
+
+	if c.CurrentContext != "" {
+		if _, ok := c.Context(c.CurrentContext); !ok {
+			errs = append(errs, fmt.Errorf("current-context references unknown context %q", c.CurrentContext))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// Merge returns c merged with others using kubectl's rules for $KUBECONFIG:
+// the first config to set current-context or preferences wins, and a cluster,
+// user, context or extension keeps the definition of the first config that
+// names it. Entries are never merged field by field.
+func (c *KubeConfig) Merge(others ...*KubeConfig) *KubeConfig {
+	merged := &KubeConfig{ApiVersion: "v1", Kind: "Config"}
+	seenClusters, seenUsers, seenContexts, seenExtensions := map[string]bool{}, map[string]bool{}, map[string]bool{}, map[string]bool{}
+
+	for _, config := range append([]*KubeConfig{c}, others...) {
+		if config == nil {
+			continue
+		}
+		if merged.CurrentContext == "" {
+			merged.CurrentContext = config.CurrentContext
+		}
+		if merged.Preferences == nil && config.Preferences != nil && (config.Preferences.Colors || len(config.Preferences.Extensions) > 0) {
+			merged.Preferences = config.Preferences
+		}
+		for _, cluster := range config.Clusters {
+			if !seenClusters[cluster.Name] {
+				seenClusters[cluster.Name] = true
+				merged.Clusters = append(merged.Clusters, cluster)
+			}
+		}
+		for _, user := range config.Users {
+			if !seenUsers[user.Name] {
+				seenUsers[user.Name] = true
+				merged.Users = append(merged.Users, user)
+			}
+		}
+		for _, context := range config.Contexts {
+			if !seenContexts[context.Name] {
+				seenContexts[context.Name] = true
+				merged.Contexts = append(merged.Contexts, context)
+			}
+		}
+		for _, extension := range config.Extensions {
+			if !seenExtensions[extension.Name] {
+				seenExtensions[extension.Name] = true
+				merged.Extensions = append(merged.Extensions, extension)
+			}
+		}
+	}
+	return merged
 }
@@ -0,0 +1,150 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/yaml"
+)
+
+const testKubeconfigFull = `
+apiVersion: v1
+kind: Config
+preferences:
+  colors: true
+current-context: eks
+clusters:
+- name: eks
+  cluster:
+    server: https://ABC.gr7.us-east-1.eks.amazonaws.com
+    certificate-authority-data: LS0tLS1CRUdJTg==
+    proxy-url: http://proxy.internal:3128
+    tls-server-name: kubernetes.default
+- name: gke
+  cluster:
+    server: https://34.1.2.3
+    certificate-authority: /etc/ca.crt
+    extensions:
+    - name: client.authentication.k8s.io/exec
+      extension:
+        audience: gke
+- name: kind
+  cluster:
+    server: https://127.0.0.1:6443
+    insecure-skip-tls-verify: true
+users:
+- name: eks
+  user:
+    exec:
+      apiVersion: client.authentication.k8s.io/v1beta1
+      command: aws
+      args: [eks, get-token, --cluster-name, prod]
+      env:
+      - name: AWS_PROFILE
+        value: prod
+      interactiveMode: IfAvailable
+      provideClusterInfo: true
+- name: gke
+  user:
+    auth-provider:
+      name: gcp
+      config:
+        cmd-path: /usr/bin/gcloud
+        expiry-key: '{.credential.token_expiry}'
+- name: kind
+  user:
+    client-certificate-data: Y2VydA==
+    client-key-data: a2V5
+    as: admin
+    as-groups: [system:masters]
+contexts:
+- name: eks
+  context:
+    cluster: eks
+    user: eks
+    namespace: payments
+- name: gke
+  context:
+    cluster: gke
+    user: gke
+- name: kind
+  context:
+    cluster: kind
+    user: kind
+extensions:
+- name: cg-controller
+  extension:
+    team: platform
+    owners: [a, b]
+`
+
+func TestKubeConfigRoundTrip(t *testing.T) {
+	config, err := ParseKubeConfig([]byte(testKubeconfigFull))
+	assert.Nil(t, err)
+	assert.Nil(t, config.Validate())
+
+	user, ok := config.User("eks")
+	assert.True(t, ok)
+	assert.Equal(t, "aws", user.Exec.Command)
+	context, ok := config.Context("eks")
+	assert.True(t, ok)
+	assert.Equal(t, "payments", context.Namespace)
+
+	original, err := yaml.YAMLToJSON([]byte(testKubeconfigFull))
+	assert.Nil(t, err)
+	roundTripped, err := json.Marshal(config)
+	assert.Nil(t, err)
+	assert.JSONEq(t, string(original), string(roundTripped))
+}
+
+func TestKubeConfigValidate(t *testing.T) {
+	config, err := ParseKubeConfig([]byte(`
+current-context: missing
+clusters:
+- name: a
+  cluster:
+    server: https://a.example.com
+- name: a
+  cluster: {}
+contexts:
+- name: a
+  context:
+    cluster: b
+    user: nobody
+`))
+	assert.Nil(t, err)
+
+	err = config.Validate()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), `cluster "a" has no server`)
+	assert.Contains(t, err.Error(), `clusters: "a" is defined more than once`)
+	assert.Contains(t, err.Error(), `context "a" references unknown cluster "b"`)
+	assert.Contains(t, err.Error(), `context "a" references unknown user "nobody"`)
+	assert.Contains(t, err.Error(), `current-context references unknown context "missing"`)
+}
+
+func TestKubeConfigMerge(t *testing.T) {
+	configA, err := ParseKubeConfig([]byte(testKubeconfigA))
+	assert.Nil(t, err)
+	configB, err := ParseKubeConfig([]byte(testKubeconfigB))
+	assert.Nil(t, err)
+
+	merged := configB.Merge(configA)
+	assert.Nil(t, merged.Validate())
+	assert.Equal(t, "b", merged.CurrentContext)
+	assert.Len(t, merged.Clusters, 3)
+	assert.Len(t, merged.Contexts, 3)
+	shared, ok := merged.Cluster("shared")
+	assert.True(t, ok)
+	assert.Equal(t, "https://shared-from-b.example.com", shared.Server)
+
+	// same answer as client-go loading both files
+	a, b := writeTestKubeconfigs(t)
+	config, err := loadKubeconfig(b+string(os.PathListSeparator)+a, "shared")
+	assert.Nil(t, err)
+	assert.Equal(t, shared.Server, config.Host)
+
+	assert.Equal(t, "a", configA.Merge(nil, configB).CurrentContext)
+}
@@ -690,3 +690,9 @@ spec:
 #    redis-cli -h 127.0.0.1 -p 6379 -a $REDIS_PASSWORD
 `
 
+
+// whole Redis install as one manifest stream for ApplyDynamicUnstructured
+const TestdeploymentYAMLRedis = TestdeploymentYAMLReadis1 + "---\n" + TestdeploymentYAMLReadis2 + "---\n" +
+	TestdeploymentYAMLReadis3 + "---\n" + TestdeploymentYAMLReadis4 + "---\n" + TestdeploymentYAMLReadis5 + "---\n" +
+	TestdeploymentYAMLReadis6 + "---\n" + TestdeploymentYAMLReadis7 + "---\n" + TestdeploymentYAMLReadis8 + "---\n" +
+	TestdeploymentYAMLReadis9 + "---\n" + TestdeploymentYAMLReadis11
@@ -2,16 +2,16 @@ package kubernetes
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	appsv1 "k8s.io/api/apps/v1"
-    netv1 "k8s.io/api/networking/v1beta1"
 	//v1beta1 "k8s.io/api/apps/v1beta1"
 	v1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/resource"
+	netv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/dynamic"
@@ -21,9 +21,7 @@ import (
 
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
-	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime/serializer/yaml"
-	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/discovery/cached/memory"
 	"k8s.io/client-go/restmapper"
@@ -38,12 +36,14 @@ var api corev1.CoreV1Interface
 var clientSet *kubernetes.Clientset
 
 type KubernetesClient struct {
-	clientset        kubernetes.Clientset
+	clientset        kubernetes.Interface
 	dynamicinterface dynamic.Interface
-	discoveryclient  *discovery.DiscoveryClient
+	discoveryclient  discovery.DiscoveryInterface
+	cacheddiscovery  discovery.CachedDiscoveryInterface
+	mapper           *restmapper.DeferredDiscoveryRESTMapper
 }
 
-func NewKubernetesClient(configBytes []byte) (*KubernetesClient, error) {
+func NewKubernetesClient(configBytes []byte, opts ...ClientOption) (*KubernetesClient, error) {
 	config, err := clientcmd.NewClientConfigFromBytes(configBytes)
 	if err != nil {
 		return nil, err
@@ -52,152 +52,68 @@ func NewKubernetesClient(configBytes []byte) (*KubernetesClient, error) {
 	if err != nil {
 		return nil, err
 	}
-	clientset, err := kubernetes.NewForConfig(clientConfig)
-	if err != nil {
-		return nil, err
-	}
-	dynamicinterface, err := dynamic.NewForConfig(clientConfig)
-	if err != nil {
-		return nil, err
-	}
+	return NewKubernetesClientForConfig(clientConfig, opts...)
+}
 
-	discoveryclient, err := discovery.NewDiscoveryClientForConfig(clientConfig)
-	if err != nil {
-		return nil, err
-	}
+// NewKubernetesClientFromInterfaces builds a client on existing clients, e.g.
+// the fake clientsets of k8s.io/client-go for tests without a cluster.
+func NewKubernetesClientFromInterfaces(clientset kubernetes.Interface, dynamicinterface dynamic.Interface, discoveryclient discovery.DiscoveryInterface) *KubernetesClient {
+	cacheddiscovery := memory.NewMemCacheClient(discoveryclient)
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(cacheddiscovery)
 
-	return &KubernetesClient{clientset: *clientset, dynamicinterface: dynamicinterface, discoveryclient: discoveryclient}, nil
+	return &KubernetesClient{clientset: clientset, dynamicinterface: dynamicinterface, discoveryclient: discoveryclient, cacheddiscovery: cacheddiscovery, mapper: mapper}
 }
 
-func (c *KubernetesClient) ListNamespaces(ctx context.Context) (*v1.NamespaceList, error) {
-	return c.clientset.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{})
+func (c *KubernetesClient) ListNamespaces(ctx context.Context, opts ...ListOptions) (*v1.NamespaceList, error) {
+	return c.clientset.CoreV1().Namespaces().List(ctx, listOptions(opts))
 }
 
+// CreateNamespace creates name with DefaultNamespaceProfile, see CreateNamespaceWithProfile.
 func (c *KubernetesClient) CreateNamespace(ctx context.Context, name string) (*v1.Namespace, error) {
-	namespace, err := c.clientset.CoreV1().Namespaces().Create(context.TODO(), &v1.Namespace{
-		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Namespace"},
-		ObjectMeta: metav1.ObjectMeta{Name: name},
-	}, metav1.CreateOptions{})
-	if err != nil {
-		return nil, err
-	}
-
-	_, err = c.clientset.CoreV1().ResourceQuotas(name).Create(context.TODO(), &v1.ResourceQuota{
-		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ResourceQuota"},
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
-			Namespace: name,
-		},
-		Spec: v1.ResourceQuotaSpec{
-			Hard: v1.ResourceList{
-				v1.ResourceLimitsCPU:      resource.MustParse("128000m"),
-				v1.ResourceLimitsMemory:   resource.MustParse("200Gi"),
-				v1.ResourceRequestsCPU:    resource.MustParse("128000m"),
-				v1.ResourceRequestsMemory: resource.MustParse("150Gi"),
-			},
-		},
-	}, metav1.CreateOptions{})
-	if err != nil {
-		return nil, err
-	}
-
-	return namespace, nil
+	return c.CreateNamespaceWithProfile(ctx, name, DefaultNamespaceProfile())
 }
 
-func (c *KubernetesClient) DeleteNamespace(ctx context.Context, name string) error {
-	var gracePeriodSeconds = int64(0)
-	return c.clientset.CoreV1().Namespaces().Delete(context.TODO(), name, metav1.DeleteOptions{GracePeriodSeconds: &gracePeriodSeconds})
+func (c *KubernetesClient) ListServices(ctx context.Context, namespace string, opts ...ListOptions) (*v1.ServiceList, error) {
+	return c.clientset.CoreV1().Services(namespace).List(ctx, listOptions(opts))
 }
 
-func (c *KubernetesClient) ListServices(ctx context.Context, namespace string) (*v1.ServiceList, error) {
-	return c.clientset.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{})
+func (c *KubernetesClient) ListPods(ctx context.Context, namespace string, opts ...ListOptions) (*v1.PodList, error) {
+	return c.clientset.CoreV1().Pods(namespace).List(ctx, listOptions(opts))
 }
 
-func (c *KubernetesClient) ListPods(ctx context.Context, namespace string) (*v1.PodList, error) {
-	return c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+func (c *KubernetesClient) ListDeploy(ctx context.Context, namespace string, opts ...ListOptions) (*appsv1.DeploymentList, error) {
+	return c.clientset.AppsV1().Deployments(namespace).List(ctx, listOptions(opts))
 }
 
-func (c *KubernetesClient) ListDeploy(ctx context.Context, namespace string) (*appsv1.DeploymentList, error) {
-	return c.clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+func (c *KubernetesClient) ListConfigmaps(ctx context.Context, namespace string, opts ...ListOptions) (*v1.ConfigMapList, error) {
+	return c.clientset.CoreV1().ConfigMaps(namespace).List(ctx, listOptions(opts))
 }
 
-func (c *KubernetesClient) ListConfigmaps(ctx context.Context, namespace string) (*v1.ConfigMapList, error) {
-	return c.clientset.CoreV1().ConfigMaps(namespace).List(ctx, metav1.ListOptions{})
+func (c *KubernetesClient) ListReplicaset(ctx context.Context, namespace string, opts ...ListOptions) (*appsv1.ReplicaSetList, error) {
+	return c.clientset.AppsV1().ReplicaSets(namespace).List(ctx, listOptions(opts))
 }
 
-func (c *KubernetesClient) ListReplicaset(ctx context.Context, namespace string) (*appsv1.ReplicaSetList, error) {
-	return c.clientset.AppsV1().ReplicaSets(namespace).List(ctx, metav1.ListOptions{})
+func (c *KubernetesClient) ListEndpoint(ctx context.Context, namespace string, opts ...ListOptions) (*v1.EndpointsList, error) {
+	return c.clientset.CoreV1().Endpoints(namespace).List(ctx, listOptions(opts))
 }
 
-func (c *KubernetesClient) ListEndpoint(ctx context.Context, namespace string) (*v1.EndpointsList, error) {
-	return c.clientset.CoreV1().Endpoints(namespace).List(ctx, metav1.ListOptions{})
-}
-
-//k8s.io/api/networking/v1
-func (c *KubernetesClient) ListIngresses(ctx context.Context, namespace string) (*netv1.IngressList, error) {
-	return c.clientset.NetworkingV1beta1().Ingresses(namespace).List(ctx, metav1.ListOptions{} )
-}
 
 func (c *KubernetesClient) CreateDeploy(ctx context.Context, namespace string, deployname string, replicas uint32, appname string, containername string, imagetag string) (*unstructured.Unstructured, error) { //(*appsv1.Deployment, error) {
+	return c.CreateDeployFromSpec(ctx, namespace, deploySpec(deployname, replicas, appname, containername, imagetag))
+}
 
-	deploymentRes := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
-	deployment := &unstructured.Unstructured{
-		Object: map[string]interface{}{
-			"apiVersion": "apps/v1",
-			"kind":       "Deployment",
-			"metadata": map[string]interface{}{
-				"name": deployname,
+func deploySpec(deployname string, replicas uint32, appname string, containername string, imagetag string) *DeploymentSpec {
+	return NewDeploymentSpec(deployname, int32(replicas)).
+		WithLabel("app", appname). //for now
+		WithContainer(v1.Container{
+			Name:            containername,
+			Image:           imagetag,
+			ImagePullPolicy: v1.PullAlways,
+			Ports: []v1.ContainerPort{
+				{Name: "http", Protocol: v1.ProtocolTCP, ContainerPort: 80},
+				{Name: "tcp", Protocol: v1.ProtocolTCP, ContainerPort: 8080},
 			},
-			"spec": map[string]interface{}{
-				"replicas": replicas,
-				"selector": map[string]interface{}{
-					"matchLabels": map[string]interface{}{
-						"app": appname, //for now
-					},
-				},
-				"template": map[string]interface{}{
-					"metadata": map[string]interface{}{
-						"labels": map[string]interface{}{
-							"app": appname, //for now
-						},
-					},
-					//portest []map[string]interface :=  { "udp", "UDP", 80 }
-					"spec": map[string]interface{}{
-						"containers": []map[string]interface{}{
-							{
-								"name":            containername,
-								"image":           imagetag,
-								"imagePullPolicy": "Always",
-								"ports": []map[string]interface{}{
-									//{
-									//  portest
-									//},
-									{
-										"name":          "http",
-										"protocol":      "TCP",
-										"containerPort": 80,
-									},
-									{"name": "tcp",
-										"protocol":      "TCP",
-										"containerPort": 8080,
-									},
-								},
-							},
-						},
-					},
-				},
-			},
-		},
-	}
-	// Create Deployment
-	fmt.Println("Creating deployment...")
-	result, err := c.dynamicinterface.Resource(deploymentRes).Namespace(namespace).Create(context.TODO(), deployment, metav1.CreateOptions{})
-	if err != nil {
-		panic(err)
-	}
-	fmt.Printf("Created deployment %q.\n", result.GetName())
-
-	return result, err
+		})
 }
 
 func (c *KubernetesClient) DeleteDeploy(ctx context.Context, namespace string, deployname string) error { //(*appsv1.Deployment, error) {
@@ -209,69 +125,31 @@ func (c *KubernetesClient) DeleteDeploy(ctx context.Context, namespace string, d
 	}
 	deploymentRes := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
 
-	var err error
-	if err = c.dynamicinterface.Resource(deploymentRes).Namespace(namespace).Delete(context.TODO(), deployname, deleteOptions); err != nil {
-		panic(err)
-	}
-
-	return err
+	err := c.dynamicinterface.Resource(deploymentRes).Namespace(namespace).Delete(context.TODO(), deployname, deleteOptions)
+	return objectError("delete", appsv1.SchemeGroupVersion.WithKind(DeploymentKind), namespace, deployname, err)
 }
 
+// CreateService creates a service of servicetype sending TCP port 80 to port 80
+// of the pods labelled app=appname, see CreateServiceFromSpec for anything else.
 func (c *KubernetesClient) CreateService(ctx context.Context, servicetype v1.ServiceType, namespace string, servicename string, appname string) error { //(*appsv1.Deployment, error) {
-	//selector,  template, container ports - port target port
-
-	coreV1Client := c.clientset.CoreV1()
-
-	service := &v1.Service{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: servicename,
-		},
-		Spec: v1.ServiceSpec{
-			Selector: map[string]string{
-				"app": appname,
-			},
-			Type: servicetype, //"ClusterIP" "NodePort" "LoadBalancer" "ExternalName"
-			Ports: []v1.ServicePort{
-				{
-					Protocol: "TCP",
-					Port:     80,
-					TargetPort: intstr.IntOrString{
-						Type:   intstr.Int,
-						IntVal: 80,
-					},
-				},
-				//{
-				//	Protocol: "UDP",
-				//	Port: 81,
-				//	TargetPort: intstr.IntOrString{
-				//		Type:   intstr.Int,
-				//		IntVal: 80,
-				//	},
-				//},
-			},
-		},
-	}
-	result, err := coreV1Client.Services(namespace).Create(context.TODO(), service, metav1.CreateOptions{})
-	if err != nil {
-		panic(err)
-	}
-	fmt.Printf("Created service %s\n", result.ObjectMeta.Name)
+	spec := NewServiceSpec(servicename, servicetype).
+		WithSelector("app", appname).
+		WithPort(ServicePortSpec{Protocol: v1.ProtocolTCP, Port: 80, TargetPort: intstr.FromInt32(80)})
+	_, err := c.CreateServiceFromSpec(ctx, namespace, spec)
 	return err
-
 }
 
 func (c *KubernetesClient) DeleteService(ctx context.Context, namespace string, servicename string) error { //(*appsv1.Deployment, error) {
 	fmt.Println("Deleting service...")
 
 	coreV1Client := c.clientset.CoreV1()
-	var err error
-	err = coreV1Client.Services(namespace).Delete(context.TODO(), servicename, metav1.DeleteOptions{})
+	err := coreV1Client.Services(namespace).Delete(context.TODO(), servicename, metav1.DeleteOptions{})
 	if err != nil {
-		panic(err)
+		return objectError("delete", v1.SchemeGroupVersion.WithKind(ServiceKind), namespace, servicename, err)
 	}
 	fmt.Printf("Deleted service \n")
 
-	return err
+	return nil
 }
 
 func (c *KubernetesClient) CreateEndpoint(ctx context.Context, namespace string, endpointname string, ip string, portname string, port int32, protocol v1.Protocol) error { //(*appsv1.Deployment, error) {
@@ -293,10 +171,10 @@ func (c *KubernetesClient) CreateEndpoint(ctx context.Context, namespace string,
 	}
 	result, err := coreV1Client.Endpoints(namespace).Create(context.TODO(), endpoints, metav1.CreateOptions{})
 	if err != nil {
-		panic(err)
+		return objectError("create", v1.SchemeGroupVersion.WithKind("Endpoints"), namespace, endpointname, err)
 	}
 	fmt.Printf("Created Endponts %s\n", result.ObjectMeta.Name)
-	return err
+	return nil
 
 }
 
@@ -307,30 +185,18 @@ func (c *KubernetesClient) DeleteEndpoint(ctx context.Context, namespace string,
 	var err error
 	err = coreV1Client.Endpoints(namespace).Delete(context.TODO(), ednpontname, metav1.DeleteOptions{})
 	if err != nil {
-		return err
+		return objectError("delete", v1.SchemeGroupVersion.WithKind("Endpoints"), namespace, ednpontname, err)
 	}
 	fmt.Printf("Deleted Endponts \n")
 
 	return nil
 }
 
+// CreateConfigmap creates a ConfigMap with the single key configit, see
+// CreateConfigMapFromSpec for several keys, files and binary data.
 func (c *KubernetesClient) CreateConfigmap(ctx context.Context, namespace string, configmapname string, configit string, configurewith string) error {
-
-	coreV1Client := c.clientset.CoreV1()
-
-	configmap := &v1.ConfigMap{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: configmapname,
-		},
-		Data: map[string]string{configit: configurewith},
-	}
-	result, err := coreV1Client.ConfigMaps(namespace).Create(context.TODO(), configmap, metav1.CreateOptions{})
-	if err != nil {
-		return err
-	}
-	fmt.Printf("Created ConfigMap %s\n", result.ObjectMeta.Name)
-	return nil
-
+	_, err := c.CreateConfigMapFromSpec(ctx, namespace, NewConfigDataSpec(configmapname).WithLiteral(configit, configurewith))
+	return err
 }
 
 func (c *KubernetesClient) DeleteConfigmap(ctx context.Context, namespace string, configmapname string) error {
@@ -340,7 +206,7 @@ func (c *KubernetesClient) DeleteConfigmap(ctx context.Context, namespace string
 	//var err error
 	err := coreV1Client.ConfigMaps(namespace).Delete(context.TODO(), configmapname, metav1.DeleteOptions{})
 	if err != nil {
-		return err
+		return objectError("delete", v1.SchemeGroupVersion.WithKind(ConfigMapKind), namespace, configmapname, err)
 	}
 	fmt.Printf("Deleted Comfigmap \n")
 	return nil
@@ -348,219 +214,198 @@ func (c *KubernetesClient) DeleteConfigmap(ctx context.Context, namespace string
 
 func (c *KubernetesClient) CreateApplicationService(ctx context.Context, namespace string, name string, replicas uint32, appname string, imagetag string,
 	servicetype v1.ServiceType, configit string, configurewith string,
-	db_endpoint string, ip string, portname string, port int32, protocol v1.Protocol) error {
-	var err error
+	db_endpoint string, ip string, portname string, port int32, protocol v1.Protocol, opts ...ApplicationOption) error {
+
+	var options applicationOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	refs := []ObjectRef{
+		{Version: "v1", Kind: ServiceKind, Namespace: namespace, Name: name},
+		{Version: "v1", Kind: ConfigMapKind, Namespace: namespace, Name: name},
+		{Group: "apps", Version: "v1", Kind: DeploymentKind, Namespace: namespace, Name: name},
+		{Version: "v1", Kind: "Endpoints", Namespace: namespace, Name: db_endpoint},
+	}
 
-	err = c.CreateService(ctx, servicetype, namespace, name, appname)
-	err = c.CreateConfigmap(ctx, namespace, name, configit, configurewith) //one config
-	_, err = c.CreateDeploy(ctx, namespace, name, replicas, appname, appname, imagetag)
-	err = c.CreateEndpoint(ctx, namespace, db_endpoint, ip, portname, port, protocol) //  one endpoint name for now
+	// all or nothing, objects already created are removed again when a step fails
+	steps := []step{
+		{
+			name: "Service " + name,
+			do: func(ctx context.Context) error {
+				return c.CreateService(ctx, servicetype, namespace, name, appname)
+			},
+			undo: func(ctx context.Context) error {
+				return c.DeleteService(ctx, namespace, name)
+			},
+		},
+		{
+			name: "ConfigMap " + name,
+			do: func(ctx context.Context) error {
+				return c.CreateConfigmap(ctx, namespace, name, configit, configurewith) //one config
+			},
+			undo: func(ctx context.Context) error {
+				return c.DeleteConfigmap(ctx, namespace, name)
+			},
+		},
+		{
+			name: "Deployment " + name,
+			do: func(ctx context.Context) error {
+				// the pods roll when the ConfigMap changes, see ConfigRolloutWatcher
+				spec := deploySpec(name, replicas, appname, appname, imagetag).
+					WithPodAnnotation(ConfigRefsAnnotation, ConfigMapKind+"/"+name)
+				_, err := c.CreateDeployFromSpec(ctx, namespace, spec)
+				return err
+			},
+			undo: func(ctx context.Context) error {
+				return c.DeleteDeploy(ctx, namespace, name)
+			},
+		},
+		{
+			name: "Endpoints " + db_endpoint,
+			do: func(ctx context.Context) error {
+				return c.CreateEndpoint(ctx, namespace, db_endpoint, ip, portname, port, protocol) //  one endpoint name for now
+			},
+			undo: func(ctx context.Context) error {
+				return c.DeleteEndpoint(ctx, namespace, db_endpoint)
+			},
+		},
+	}
+	if options.ingress != nil {
+		ingress := *options.ingress
+		if ingress.Name == "" {
+			ingress.Name = name
+		}
+		steps = append(steps, step{
+			name: "Ingress " + ingress.Name,
+			do: func(ctx context.Context) error {
+				if _, err := c.CreateIngressFromSpec(ctx, namespace, &ingress); err != nil {
+					return err
+				}
+				// recorded in the version it was created in, v1beta1 on older clusters
+				version, err := c.ingressVersion()
+				if err != nil {
+					return err
+				}
+				refs = append(refs, ObjectRef{Group: netv1.GroupName, Version: version, Kind: IngressKind, Namespace: namespace, Name: ingress.Name})
+				return nil
+			},
+			undo: func(ctx context.Context) error {
+				return c.DeleteIngress(ctx, namespace, ingress.Name)
+			},
+		})
+	}
+	steps = append(steps, step{
+		name: "Release " + name,
+		do: func(ctx context.Context) error {
+			return c.recordApplicationRelease(ctx, namespace, name, refs)
+		},
+	})
+	if err := runSteps(ctx, steps); err != nil {
+		return err
+	}
 
 	fmt.Printf("creaed CG service \n")
-	return err
+	return nil
 }
 
+// DeleteApplicationService uninstalls the release CreateApplicationService
+// recorded. Services created before releases were recorded have no inventory,
+// their objects are deleted by name.
 func (c *KubernetesClient) DeleteApplicationService(ctx context.Context, namespace string, name string, db_endpoint string) error {
-	var err error
-	err = c.DeleteService(ctx, namespace, name)
-	err = c.DeleteConfigmap(ctx, namespace, name) //one config
-	err = c.DeleteDeploy(ctx, namespace, name)
-	err = c.DeleteEndpoint(ctx, namespace, db_endpoint) //  one endpoint name for now
+	_, err := c.GetRelease(ctx, namespace, name)
+	if err == nil {
+		if err := c.UninstallRelease(ctx, namespace, name); err != nil {
+			return err
+		}
+		fmt.Printf("deleted CG service \n")
+		return nil
+	}
+	if !IsNotFound(err) {
+		return err
+	}
+
+	// without a release there is no Ingress either, WithIngress came later
+	errs := utilerrors.NewAggregate([]error{
+		c.DeleteService(ctx, namespace, name),
+		c.DeleteConfigmap(ctx, namespace, name), //one config
+		c.DeleteDeploy(ctx, namespace, name),
+		c.DeleteEndpoint(ctx, namespace, db_endpoint), //  one endpoint name for now
+	})
 	fmt.Printf("deleted CG service \n")
-	return err
+	return errs
 }
 
 var decUnstructured = yaml.NewDecodingSerializer(unstructured.UnstructuredJSONScheme)
 
-func (c *KubernetesClient) CreateDynamicUnstructured(ctx context.Context, yaml string) error {
-
-	dc := c.discoveryclient
-	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(dc))
-	dyn := c.dynamicinterface
-
-	//	var decUnstructured = yaml.NewDecodingSerializer(unstructured.UnstructuredJSONScheme)
+func decodeObject(manifest YAML) (*unstructured.Unstructured, error) {
 	obj := &unstructured.Unstructured{}
-	_, gvk, err := decUnstructured.Decode([]byte(yaml), nil, obj)
-	if err != nil {
-		panic(err)
-	}
-	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
-	if err != nil {
-		panic(err)
-	}
-	var dr dynamic.ResourceInterface
-	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
-		// namespaced resources should specify the namespace
-		dr = dyn.Resource(mapping.Resource).Namespace(obj.GetNamespace())
-	} else {
-		// for cluster-wide resources
-		dr = dyn.Resource(mapping.Resource)
+	if _, _, err := decUnstructured.Decode([]byte(manifest), nil, obj); err != nil {
+		return nil, decodeError(err)
 	}
+	return obj, nil
+}
 
-	data, err := json.Marshal(obj)
-	if err != nil {
-		panic(err)
-	}
+func (c *KubernetesClient) CreateDynamicUnstructured(ctx context.Context, yaml string) error {
 
-	_, err = dr.Patch(ctx, obj.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{
-		FieldManager: "cg-controller",
-	})
+	obj, err := decodeObject(yaml)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
+	_, err = c.applyObject(ctx, obj, ApplyOptions{})
+
 	//time.Sleep (500*1000*time.Millisecond )
 	return err
 }
 
-type runStruct struct {
-	Kind        string
-}
-
-
-
+// Deprecated: ProcessEventDeploy only prints a raw watch until its channel
+// closes, use EventWatcher for typed handlers that survive watch expiry.
 func ProcessEventDeploy(watchmy watch.Interface) {
-	for {
-		event := <-watchmy.ResultChan()
-		fmt.Printf("\n\nafter event := <-ch  %v \n", event )
-		fmt.Printf("after event := <-ch  ===Type %v  \n", event.Type )
-		////fmt.Printf("after event := <-ch  ===Object %v  \n", event.Object.GetObjectKind() )
-        // some outputs to discover
-		//fmt.Printf("after event := <-ch  ===Object %v  \n", event.Object.GetObjectKind())
-		//fmt.Printf("after event := <-ch  ===: %v  \n", event.Object.DeepCopyObject().GetObjectKind())
-		//fmt.Printf("after event := <-ch  ===> %v  \n", event.Object.DeepCopyObject())
-		//myType :=  event.Type
-		//myObject := event.Object
-		//mysomethingC := myObject.DeepCopyObject()
-		//mysomething := mysomethingC
-		//fmt.Printf("something ---------: %v \n", mysomething)
-
-		p := event.Object.GetObjectKind()
-		// convert map to json
-		jsonString, _ := json.Marshal(p)
-
-		check := runStruct{}
-		json.Unmarshal(jsonString, &check)
-		fmt.Printf( "event Kind -> : %s \n",  check.Kind)
-		fmt.Printf("@@ event is Kind of  -%s- \n", check.Kind)
-
-		//going for .....
-		if ( check.Kind == "Deployment" ) {
-			fmt.Printf("is Kind  -%s- Deployment ? \n", check.Kind)
-			s := appsv1.Deployment{}
-			json.Unmarshal(jsonString, &s)
-			fmt.Println("Name:",s.Name, " namespace: ", s.Namespace, " spec replicas:", *(s.Spec.Replicas), " status Replicas:", s.Status.Replicas, " status Replicas:",  s.Status.ReadyReplicas)
-		}
-		if ( check.Kind == "StatefulSet" ) {
-			fmt.Printf("is Kind  -%s- StatefulSet ? \n", check.Kind)
-			s := appsv1.StatefulSet{}
-			json.Unmarshal(jsonString, &s)
-			fmt.Println("Name:",s.Name, " namespace: ", s.Namespace, " spec replicas:", *(s.Spec.Replicas), " status Replicas:", s.Status.Replicas, " status Replicas:",  s.Status.ReadyReplicas)
-		}
-		if ( check.Kind == "DaemonSet" ) {
-			fmt.Printf("is Kind  -%s- DaemonSet ? \n", check.Kind)
-			s := appsv1.StatefulSet{}
-			json.Unmarshal(jsonString, &s)
-			fmt.Println("Name:",s.Name, " namespace: ", s.Namespace, " spec replicas:", *(s.Spec.Replicas), " status Replicas:", s.Status.Replicas, " status Replicas:",  s.Status.ReadyReplicas)
+	for event := range watchmy.ResultChan() {
+		if event.Type == watch.Error {
+			fmt.Printf("watch error: %v \n", apierrors.FromObject(event.Object))
+			continue
 		}
-		if ( check.Kind == "Service" ) {
-			fmt.Printf("is Kind  -%s- Service ? \n", check.Kind)
-			s := v1.Service{}
-			json.Unmarshal(jsonString, &s)
-			fmt.Println("Name:",s.Name, " namespace: ", s.Namespace )
-		}
-		if ( check.Kind == "ConfigMap" ) {
-			fmt.Printf("is Kind  -%s- ConfigMap ? \n", check.Kind)
-			s := v1.ConfigMap{}
-			json.Unmarshal(jsonString, &s)
-			fmt.Println("Name:",s.Name, " namespace: ", s.Namespace )
-		}
-		if ( check.Kind == "Secret" ) {
-			fmt.Printf("is Kind  -%s- Secret ? \n", check.Kind)
-			s := v1.Secret{}
-			json.Unmarshal(jsonString, &s)
-			fmt.Println("Name:",s.Name, " namespace: ", s.Namespace )
-		}
-		if ( check.Kind == "ServiceAccount" ) {
-			fmt.Printf("is Kind  -%s- Secret ? \n", check.Kind)
-			s := v1.ServiceAccount{}
-			json.Unmarshal(jsonString, &s)
-			fmt.Println("Name:",s.Name, " namespace: ", s.Namespace )
-		}
-		if ( check.Kind == "Ingress" ) {
-			fmt.Printf("is Kind  -%s- Ingress ? \n", check.Kind)
-			s := netv1.Ingress{}
-			json.Unmarshal(jsonString, &s)
-			fmt.Println("Name:",s.Name, " namespace: ", s.Namespace, " status: ", s.Status , " spec: ", s.Spec/*.Rules*/ )
-		}
-
+		printEvent(string(event.Type), toTyped(event.Object))
 	}
+	fmt.Printf("watch channel closed \n")
 }
 
 
 func (c *KubernetesClient) DeleteDynamicUnstructured(ctx context.Context, yaml string) error {
 
-	dc := c.discoveryclient
-	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(dc))
-	dyn := c.dynamicinterface
-
-	//	var decUnstructured = yaml.NewDecodingSerializer(unstructured.UnstructuredJSONScheme)
-	obj := &unstructured.Unstructured{}
-	_, gvk, err := decUnstructured.Decode([]byte(yaml), nil, obj)
+	obj, err := decodeObject(yaml)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	dr, err := c.resourceFor(obj)
 	if err != nil {
-		panic(err)
-	}
-	var dr dynamic.ResourceInterface
-	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
-		// namespaced resources should specify the namespace
-		dr = dyn.Resource(mapping.Resource).Namespace(obj.GetNamespace())
-	} else {
-		// for cluster-wide resources
-		dr = dyn.Resource(mapping.Resource)
+		return objectError("delete", obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName(), err)
 	}
 
-	obj.GetName()
 	err = dr.Delete(ctx, obj.GetName(), metav1.DeleteOptions{})
-	if err != nil {
-		panic(err)
-	}
-	return err
+	return objectError("delete", obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName(), err)
 }
 
 
 func (c *KubernetesClient) EventsDynamicUnstructured(ctx context.Context, yaml string/*, run func(watch.Interface)*/) (watch.Interface, error) {
 
-	dc := c.discoveryclient
-	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(dc))
-	dyn := c.dynamicinterface
-
-	//	var decUnstructured = yaml.NewDecodingSerializer(unstructured.UnstructuredJSONScheme)
-	obj := &unstructured.Unstructured{}
-	_, gvk, err := decUnstructured.Decode([]byte(yaml), nil, obj)
+	obj, err := decodeObject(yaml)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	gvk := obj.GroupVersionKind()
+	mapping, err := c.restMapping(gvk)
 	if err != nil {
-		panic(err)
-	}
-	var dr dynamic.ResourceInterface
-	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
-		// namespaced resources should specify the namespace
-		dr = dyn.Resource(mapping.Resource).Namespace(obj.GetNamespace())
-	} else {
-		// for cluster-wide resources
-		dr = dyn.Resource(mapping.Resource)
+		return nil, objectError("watch", gvk, obj.GetNamespace(), "", err)
 	}
+	// an empty namespace watches all namespaces
+	dr := c.resourceInterface(mapping, obj.GetNamespace())
 
 	var watchmy watch.Interface
 	watchmy, err = dr.Watch(ctx, metav1.ListOptions{})
 	if err != nil {
-		panic(err.Error())
+		return nil, objectError("watch", gvk, obj.GetNamespace(), "", err)
 	}
 	fmt.Printf("watchmy  Watch fine \n")
 
@@ -569,7 +414,7 @@ func (c *KubernetesClient) EventsDynamicUnstructured(ctx context.Context, yaml s
 	//	klog.V(4).Infof("error recording current command: %v", err)
 	//}
 
-	return watchmy, err
+	return watchmy, nil
 }
 
 
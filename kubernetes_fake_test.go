@@ -0,0 +1,359 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	ktesting "k8s.io/client-go/testing"
+)
+
+// Offline counterparts of kubernetes_test.go, they run against newFakeCluster.
+
+const fakeConfigMapYAML = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  namespace: default
+data:
+  mode: fast
+`
+
+const fakeDeploymentYAML = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: default
+spec:
+  replicas: 2
+  selector:
+    matchLabels:
+      app: web
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      containers:
+      - name: web
+        image: nginx:1.25
+`
+
+func TestFakeNamespaces(t *testing.T) {
+	client := newFakeCluster().client
+	ctx := context.Background()
+
+	_, err := client.CreateNamespace(ctx, "cg")
+	assert.Nil(t, err)
+	// creating it again is fine
+	_, err = client.CreateNamespace(ctx, "cg")
+	assert.Nil(t, err)
+
+	namespaces, err := client.ListNamespaces(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, namespaces.Items, 1)
+	quota, err := client.clientset.CoreV1().ResourceQuotas("cg").Get(ctx, "cg", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "200Gi", quota.Spec.Hard.Name(v1.ResourceLimitsMemory, "").String())
+
+	assert.Nil(t, client.DeleteNamespace(ctx, "cg"))
+	assert.True(t, IsNotFound(client.DeleteNamespace(ctx, "cg")))
+}
+
+func TestFakeLists(t *testing.T) {
+	client := newFakeCluster(
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "default"}},
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "web-1234", Namespace: "default"}},
+		&netv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}},
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "other"}},
+	).client
+	ctx := context.Background()
+
+	pods, err := client.ListPods(ctx, "default")
+	assert.Nil(t, err)
+	assert.Len(t, pods.Items, 1)
+	pods, err = client.ListPods(ctx, "")
+	assert.Nil(t, err)
+	assert.Len(t, pods.Items, 2)
+
+	replicasets, err := client.ListReplicaset(ctx, "default")
+	assert.Nil(t, err)
+	assert.Len(t, replicasets.Items, 1)
+
+	ingresses, err := client.ListIngresses(ctx, "default")
+	assert.Nil(t, err)
+	assert.Len(t, ingresses.Items, 1)
+}
+
+func TestFakeServiceConfigmapEndpoint(t *testing.T) {
+	client := newFakeCluster().client
+	ctx := context.Background()
+
+	assert.Nil(t, client.CreateService(ctx, v1.ServiceTypeClusterIP, "default", "web", "web"))
+	assert.Nil(t, client.CreateConfigmap(ctx, "default", "web", "mode", "fast"))
+	assert.Nil(t, client.CreateEndpoint(ctx, "default", "db", "10.0.0.5", "postgres", 5432, v1.ProtocolTCP))
+
+	services, err := client.ListServices(ctx, "default")
+	assert.Nil(t, err)
+	assert.Len(t, services.Items, 1)
+	assert.Equal(t, "web", services.Items[0].Spec.Selector["app"])
+
+	configmaps, err := client.ListConfigmaps(ctx, "default")
+	assert.Nil(t, err)
+	assert.Len(t, configmaps.Items, 1)
+	assert.Equal(t, "fast", configmaps.Items[0].Data["mode"])
+
+	endpoints, err := client.ListEndpoint(ctx, "default")
+	assert.Nil(t, err)
+	assert.Len(t, endpoints.Items, 1)
+	assert.Equal(t, "10.0.0.5", endpoints.Items[0].Subsets[0].Addresses[0].IP)
+
+	assert.True(t, IsConflict(client.CreateService(ctx, v1.ServiceTypeClusterIP, "default", "web", "web")))
+
+	assert.Nil(t, client.DeleteService(ctx, "default", "web"))
+	assert.Nil(t, client.DeleteConfigmap(ctx, "default", "web"))
+	assert.Nil(t, client.DeleteEndpoint(ctx, "default", "db"))
+	assert.True(t, IsNotFound(client.DeleteService(ctx, "default", "web")))
+	assert.True(t, IsNotFound(client.DeleteConfigmap(ctx, "default", "web")))
+	assert.True(t, IsNotFound(client.DeleteEndpoint(ctx, "default", "db")))
+}
+
+func TestFakeDeploy(t *testing.T) {
+	client := newFakeCluster().client
+	ctx := context.Background()
+
+	deployment, err := client.CreateDeploy(ctx, "default", "web", 2, "web", "nginx", "nginx:1.25")
+	assert.Nil(t, err)
+	assert.Equal(t, "web", deployment.GetName())
+
+	deployments, err := client.ListDeploy(ctx, "default")
+	assert.Nil(t, err)
+	assert.Len(t, deployments.Items, 1)
+	assert.Equal(t, int32(2), *deployments.Items[0].Spec.Replicas)
+	assert.Equal(t, "nginx:1.25", deployments.Items[0].Spec.Template.Spec.Containers[0].Image)
+
+	assert.Nil(t, client.DeleteDeploy(ctx, "default", "web"))
+	assert.True(t, IsNotFound(client.DeleteDeploy(ctx, "default", "web")))
+}
+
+func TestFakeWaitForReady(t *testing.T) {
+	replicas := int32(1)
+	ready := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "ready", Namespace: "default"},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas, Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "ready"}}},
+		Status:     appsv1.DeploymentStatus{UpdatedReplicas: 1, AvailableReplicas: 1},
+	}
+	pending := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "pending", Namespace: "default"},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas, Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "pending"}}},
+	}
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pending-1", Namespace: "default", Labels: map[string]string{"app": "pending"}},
+		Status: v1.PodStatus{Phase: v1.PodPending, ContainerStatuses: []v1.ContainerStatus{{
+			Name:  "web",
+			State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "ImagePullBackOff", Message: "Back-off pulling image"}},
+		}}},
+	}
+	client := newFakeCluster(ready, pending, pod).client
+	gvk := appsv1.SchemeGroupVersion.WithKind(DeploymentKind)
+
+	assert.Nil(t, client.WaitForReady(context.Background(), gvk, "default", "ready"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := client.WaitForReady(ctx, gvk, "default", "pending")
+	var notReady *NotReadyError
+	assert.True(t, errors.As(err, &notReady))
+	assert.Equal(t, "0 of 1 replicas updated", notReady.Report.Reason)
+	assert.Len(t, notReady.Report.FailingPods, 1)
+}
+
+func TestFakeWaitForReadyRetriesErrors(t *testing.T) {
+	cluster := newFakeCluster()
+	cluster.dynamic.PrependReactor("get", "deployments", func(action ktesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewTooManyRequests("slow down", 1)
+	})
+	gvk := appsv1.SchemeGroupVersion.WithKind(DeploymentKind)
+
+	// throttling does not end the wait, the report tells what went wrong
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := cluster.client.WaitForReady(ctx, gvk, "default", "web")
+	var notReady *NotReadyError
+	assert.True(t, errors.As(err, &notReady))
+	assert.Contains(t, notReady.Report.Reason, "get failed")
+}
+
+func TestFakeReleaseNoPruneOnFailure(t *testing.T) {
+	client := newFakeCluster().client
+	ctx := context.Background()
+	configmap := strings.Replace(fakeConfigMapYAML, "  namespace: default\n", "", 1)
+
+	_, err := client.InstallRelease(ctx, "default", "web", YAML(configmap+"---\n"+fakeDeploymentYAML), ApplyOptions{})
+	assert.Nil(t, err)
+	release, err := client.GetRelease(ctx, "default", "web")
+	assert.Nil(t, err)
+	assert.Contains(t, release.Objects, ObjectRef{Version: "v1", Kind: ConfigMapKind, Namespace: "default", Name: "settings"})
+
+	// the Widget fails, the ConfigMap left out of the manifests is kept
+	widget := "apiVersion: example.com/v1\nkind: Widget\nmetadata:\n  name: w\n"
+	report, err := client.UpgradeRelease(ctx, "default", "web", YAML(fakeDeploymentYAML+"---\n"+widget), ApplyOptions{Prune: true})
+	assert.Nil(t, err)
+	assert.Len(t, report.Failed(), 1)
+	assert.Empty(t, report.Pruned)
+	_, err = client.clientset.CoreV1().ConfigMaps("default").Get(ctx, "settings", metav1.GetOptions{})
+	assert.Nil(t, err)
+}
+
+func TestFakeApplicationService(t *testing.T) {
+	cluster := newFakeCluster()
+	client := cluster.client
+	ctx := context.Background()
+
+	err := client.CreateApplicationService(ctx, "default", "web", 1, "web", "nginx:1.25",
+		v1.ServiceTypeClusterIP, "mode", "fast", "db", "10.0.0.5", "postgres", 5432, v1.ProtocolTCP)
+	assert.Nil(t, err)
+
+	release, err := client.GetRelease(ctx, "default", "web")
+	assert.Nil(t, err)
+	assert.Len(t, release.Objects, 4)
+	labelled, err := cluster.dynamic.Resource(schema.GroupVersionResource{Version: "v1", Resource: "services"}).Namespace("default").Get(ctx, "web", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "web", labelled.GetLabels()[ReleaseLabel])
+
+	assert.Nil(t, client.DeleteApplicationService(ctx, "default", "web", "db"))
+	deployments, err := client.ListDeploy(ctx, "default")
+	assert.Nil(t, err)
+	assert.Empty(t, deployments.Items)
+	endpoints, err := client.ListEndpoint(ctx, "default")
+	assert.Nil(t, err)
+	assert.Empty(t, endpoints.Items)
+	_, err = client.GetRelease(ctx, "default", "web")
+	assert.True(t, IsNotFound(err))
+	releases, err := client.ListReleases(ctx, "default")
+	assert.Nil(t, err)
+	assert.Empty(t, releases)
+}
+
+func TestFakeApplicationServiceRollsBack(t *testing.T) {
+	// the Endpoints step fails, everything created before it is removed again
+	client := newFakeCluster(&v1.Endpoints{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default"}}).client
+	ctx := context.Background()
+
+	err := client.CreateApplicationService(ctx, "default", "web", 1, "web", "nginx:1.25",
+		v1.ServiceTypeClusterIP, "mode", "fast", "db", "10.0.0.5", "postgres", 5432, v1.ProtocolTCP)
+	var transactionErr *TransactionError
+	assert.True(t, errors.As(err, &transactionErr))
+	assert.True(t, IsConflict(err))
+
+	services, _ := client.ListServices(ctx, "default")
+	assert.Empty(t, services.Items)
+	configmaps, _ := client.ListConfigmaps(ctx, "default")
+	assert.Empty(t, configmaps.Items)
+	deployments, _ := client.ListDeploy(ctx, "default")
+	assert.Empty(t, deployments.Items)
+}
+
+func TestFakeDynamicUnstructured(t *testing.T) {
+	client := newFakeCluster().client
+	ctx := context.Background()
+
+	assert.Nil(t, client.CreateDynamicUnstructured(ctx, fakeDeploymentYAML))
+	// applying again updates in place
+	assert.Nil(t, client.CreateDynamicUnstructured(ctx, fakeDeploymentYAML))
+	deployments, err := client.ListDeploy(ctx, "default")
+	assert.Nil(t, err)
+	assert.Len(t, deployments.Items, 1)
+
+	assert.Nil(t, client.DeleteDynamicUnstructured(ctx, fakeDeploymentYAML))
+	assert.True(t, IsNotFound(client.DeleteDynamicUnstructured(ctx, fakeDeploymentYAML)))
+	assert.True(t, IsDecodeError(client.CreateDynamicUnstructured(ctx, "kind: [")))
+}
+
+func TestFakeEventsDynamicUnstructured(t *testing.T) {
+	client := newFakeCluster().client
+	ctx := context.Background()
+
+	watcher, err := client.EventsDynamicUnstructured(ctx, fakeDeploymentYAML)
+	assert.Nil(t, err)
+
+	assert.Nil(t, client.CreateDynamicUnstructured(ctx, fakeDeploymentYAML))
+	select {
+	case event := <-watcher.ResultChan():
+		assert.Equal(t, watch.Added, event.Type)
+		assert.IsType(t, &appsv1.Deployment{}, toTyped(event.Object))
+	case <-time.After(5 * time.Second):
+		t.Fatal("no watch event")
+	}
+
+	// ProcessEventDeploy drains the watch and returns once it is stopped
+	done := make(chan struct{})
+	EventsInstallCallDynamicUnstructured(func(w watch.Interface) {
+		ProcessEventDeploy(w)
+		close(done)
+	}, watcher)
+	assert.Nil(t, client.DeleteDynamicUnstructured(ctx, fakeDeploymentYAML))
+	watcher.Stop()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ProcessEventDeploy did not return")
+	}
+}
+
+func TestFakeRelease(t *testing.T) {
+	client := newFakeCluster().client
+	ctx := context.Background()
+	manifests := YAML(fakeConfigMapYAML + "---\n" + fakeDeploymentYAML)
+
+	report, err := client.InstallRelease(ctx, "default", "web", manifests, ApplyOptions{DryRun: true})
+	assert.Nil(t, err)
+	assert.Len(t, report.Results, 2)
+	_, err = client.GetRelease(ctx, "default", "web")
+	assert.True(t, IsNotFound(err))
+
+	report, err = client.InstallRelease(ctx, "default", "web", manifests, ApplyOptions{})
+	assert.Nil(t, err)
+	assert.Nil(t, report.Err())
+	_, err = client.InstallRelease(ctx, "default", "web", manifests, ApplyOptions{})
+	assert.NotNil(t, err)
+
+	releases, err := client.ListReleases(ctx, "default")
+	assert.Nil(t, err)
+	assert.Len(t, releases, 1)
+	assert.Len(t, releases[0].Objects, 2)
+	configmap, err := client.clientset.CoreV1().ConfigMaps("default").Get(ctx, "settings", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "web", configmap.Labels[ReleaseLabel])
+
+	// the ConfigMap is dropped from the release and pruned
+	report, err = client.UpgradeRelease(ctx, "default", "web", YAML(fakeDeploymentYAML), ApplyOptions{Prune: true})
+	assert.Nil(t, err)
+	assert.Len(t, report.Pruned, 1)
+	_, err = client.clientset.CoreV1().ConfigMaps("default").Get(ctx, "settings", metav1.GetOptions{})
+	assert.True(t, IsNotFound(err))
+	release, err := client.GetRelease(ctx, "default", "web")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, release.Revision)
+	assert.Len(t, release.Objects, 1)
+
+	assert.Nil(t, client.UninstallRelease(ctx, "default", "web"))
+	deployments, err := client.ListDeploy(ctx, "default")
+	assert.Nil(t, err)
+	assert.Empty(t, deployments.Items)
+	_, err = client.GetRelease(ctx, "default", "web")
+	assert.True(t, IsNotFound(err))
+}
@@ -8,9 +8,11 @@ import (
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"io/ioutil"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"os"
 	"path"
 	"sigs.k8s.io/yaml"
+	"strings"
 	"testing"
 	"time"
 )
@@ -28,6 +30,15 @@ func TestListNamespaces(t *testing.T) {
 	assert.NotNil(t, namespaces)
 }
 
+func TestNewKubernetesClientFromKubeconfig(t *testing.T) {
+	client, err := NewKubernetesClientFromKubeconfig("", "", WithQPS(20), WithBurst(40), WithTimeout(30*time.Second))
+	assert.Nil(t, err)
+
+	namespaces, err := client.ListNamespaces(context.Background())
+	assert.Nil(t, err)
+	assert.NotNil(t, namespaces)
+}
+
 func TestListServices(t *testing.T) {
 	bytes, err := ioutil.ReadFile(path.Join(os.Getenv("HOME"), ".kube", "config"))
 	var config KubeConfig
@@ -134,6 +145,26 @@ func TestCreateDeploy(t *testing.T) {
 
 }
 
+func TestCreateDeployWaitForReady(t *testing.T) {
+	bytes, err := ioutil.ReadFile(path.Join(os.Getenv("HOME"), ".kube", "config"))
+	var config KubeConfig
+	err = yaml.Unmarshal(bytes, &config)
+	bytes, err = json.Marshal(config)
+
+	client, err := NewKubernetesClient(bytes)
+
+	_, err = client.CreateDeploy(context.Background(), "default", "deploy-ready", 1, "app-ready", "container-name", "nginx:1.12")
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	err = client.WaitForReady(ctx, schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: DeploymentKind}, "default", "deploy-ready")
+	assert.Nil(t, err)
+
+	err = client.DeleteDeploy(context.Background(), "default", "deploy-ready")
+	assert.Nil(t, err)
+}
+
 func TestDeleteDeploy(t *testing.T) {
 	bytes, err := ioutil.ReadFile(path.Join(os.Getenv("HOME"), ".kube", "config"))
 	var config KubeConfig
@@ -303,6 +334,75 @@ func TestRedisCreateDynamicUnstructured(t *testing.T) {
 	fmt.Printf("RedisDynamic created  \n")
 }
 
+func TestRedisApplyDynamicUnstructured(t *testing.T) {
+	bytes, err := ioutil.ReadFile(path.Join(os.Getenv("HOME"), ".kube", "config"))
+	var config KubeConfig
+	err = yaml.Unmarshal(bytes, &config)
+	bytes, err = json.Marshal(config)
+
+	client, err := NewKubernetesClient(bytes)
+
+	report, err := client.ApplyDynamicUnstructured(context.Background(), TestdeploymentYAMLRedis, ApplyOptions{})
+	assert.Nil(t, err)
+	assert.Nil(t, report.Err())
+	assert.Len(t, report.Results, 10)
+}
+
+func TestRedisRelease(t *testing.T) {
+	bytes, err := ioutil.ReadFile(path.Join(os.Getenv("HOME"), ".kube", "config"))
+	var config KubeConfig
+	err = yaml.Unmarshal(bytes, &config)
+	bytes, err = json.Marshal(config)
+
+	client, err := NewKubernetesClient(bytes)
+
+	report, err := client.InstallRelease(context.Background(), "default", "my-release", TestdeploymentYAMLRedis, ApplyOptions{})
+	assert.Nil(t, err)
+	assert.Nil(t, report.Err())
+
+	releases, err := client.ListReleases(context.Background(), "default")
+	assert.Nil(t, err)
+	assert.NotEmpty(t, releases)
+
+	release, err := client.GetRelease(context.Background(), "default", "my-release")
+	assert.Nil(t, err)
+	assert.Len(t, release.Objects, 10)
+
+	// health ConfigMap dropped from the manifests
+	withoutHealth := strings.Replace(TestdeploymentYAMLRedis, TestdeploymentYAMLReadis4, "", 1)
+	report, err = client.UpgradeRelease(context.Background(), "default", "my-release", withoutHealth, ApplyOptions{Prune: true, DryRun: true})
+	assert.Nil(t, err)
+	assert.Len(t, report.Pruned, 1)
+	report, err = client.UpgradeRelease(context.Background(), "default", "my-release", withoutHealth, ApplyOptions{Prune: true})
+	assert.Nil(t, err)
+	assert.Nil(t, report.Err())
+	release, err = client.GetRelease(context.Background(), "default", "my-release")
+	assert.Nil(t, err)
+	assert.Len(t, release.Objects, 9)
+
+	err = client.UninstallRelease(context.Background(), "default", "my-release")
+	assert.Nil(t, err)
+}
+
+func TestRedisDryRunApplyDynamicUnstructured(t *testing.T) {
+	bytes, err := ioutil.ReadFile(path.Join(os.Getenv("HOME"), ".kube", "config"))
+	var config KubeConfig
+	err = yaml.Unmarshal(bytes, &config)
+	bytes, err = json.Marshal(config)
+
+	client, err := NewKubernetesClient(bytes)
+
+	report, err := client.ApplyDynamicUnstructured(context.Background(), TestdeploymentYAMLRedis, ApplyOptions{DryRun: true})
+	assert.Nil(t, err)
+	assert.Nil(t, report.Err())
+	for _, result := range report.Results {
+		fmt.Printf("%s %s/%s\n", result.GVK.Kind, result.Namespace, result.Name)
+		for _, change := range result.Diff {
+			fmt.Printf("  %s\n", change)
+		}
+	}
+}
+
 const TestdeploymentYAMLDeploy = `
 apiVersion: apps/v1
 kind: Deployment
@@ -310,7 +410,7 @@ metadata:
   namespace: skornfeld
 `
 const TestdeploymentYAMLIngress= `
-apiVersion: extensions/v1beta1
+apiVersion: networking.k8s.io/v1
 kind: Ingress
 metadata:
   namespace: skornfeld
@@ -393,6 +493,34 @@ func TestRedisEventsDynamicUnstructured(t *testing.T) {
 	time.Sleep (10000*1000*time.Millisecond ) // let it go at some time for now, forever later
 }
 
+func TestRedisEventWatcher(t *testing.T) {
+	bytes, err := ioutil.ReadFile(path.Join(os.Getenv("HOME"), ".kube", "config"))
+	var config KubeConfig
+	err = yaml.Unmarshal(bytes, &config)
+	bytes, err = json.Marshal(config)
+
+	client, err := NewKubernetesClient(bytes)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	watcher := client.NewEventWatcher("default", 5*time.Minute)
+	for _, gvk := range []schema.GroupVersionKind{
+		{Version: "v1", Kind: ServiceAccountKind},
+		{Version: "v1", Kind: SecretKind},
+		{Version: "v1", Kind: ConfigMapKind},
+		{Version: "v1", Kind: ServiceKind},
+		{Group: "apps", Version: "v1", Kind: StatefulSetKind},
+		{Group: "apps", Version: "v1", Kind: DeploymentKind},
+	} {
+		err = watcher.AddHandler(gvk, PrintEventHandler())
+		assert.Nil(t, err)
+	}
+	err = watcher.Start(ctx)
+	assert.Nil(t, err)
+
+	<-ctx.Done()
+}
+
 
 func TestCreateDynamicUnstructured(t *testing.T) {
 	bytes, err := ioutil.ReadFile(path.Join(os.Getenv("HOME"), ".kube", "config"))
@@ -0,0 +1,82 @@
+package kubernetes
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const defaultPageSize = 500
+
+// ListOptions narrow down the List* methods. With a Limit the server returns
+// at most Limit items and the list's Continue token, pass it back in Continue
+// for the next page. ListPages and ListEach do that for you.
+type ListOptions struct {
+	LabelSelector string // e.g. "app=web,tier!=cache"
+	FieldSelector string // e.g. "status.phase=Running"
+	Limit         int64
+	Continue      string
+}
+
+// listOptions folds the optional options of a List* call, later non-empty fields win.
+func listOptions(opts []ListOptions) metav1.ListOptions {
+	var listOptions metav1.ListOptions
+	for _, opt := range opts {
+		if opt.LabelSelector != "" {
+			listOptions.LabelSelector = opt.LabelSelector
+		}
+		if opt.FieldSelector != "" {
+			listOptions.FieldSelector = opt.FieldSelector
+		}
+		if opt.Limit != 0 {
+			listOptions.Limit = opt.Limit
+		}
+		if opt.Continue != "" {
+			listOptions.Continue = opt.Continue
+		}
+	}
+	return listOptions
+}
+
+// ListPages lists gvk in namespace ("" for all namespaces) one page at a time
+// and calls fn for each page. A Limit of 0 uses pages of 500 items. An error
+// from fn stops the listing and is returned.
+func (c *KubernetesClient) ListPages(ctx context.Context, gvk schema.GroupVersionKind, namespace string, opts ListOptions, fn func(page *unstructured.UnstructuredList) error) error {
+	mapping, err := c.restMapping(gvk)
+	if err != nil {
+		return objectError("list", gvk, namespace, "", err)
+	}
+	dr := c.resourceInterface(mapping, namespace)
+
+	listOptions := listOptions([]ListOptions{opts})
+	if listOptions.Limit == 0 {
+		listOptions.Limit = defaultPageSize
+	}
+	for {
+		page, err := dr.List(ctx, listOptions)
+		if err != nil {
+			return objectError("list", gvk, namespace, "", err)
+		}
+		if err := fn(page); err != nil {
+			return err
+		}
+		listOptions.Continue = page.GetContinue()
+		if listOptions.Continue == "" {
+			return nil
+		}
+	}
+}
+
+// ListEach is ListPages calling fn for every item.
+func (c *KubernetesClient) ListEach(ctx context.Context, gvk schema.GroupVersionKind, namespace string, opts ListOptions, fn func(item *unstructured.Unstructured) error) error {
+	return c.ListPages(ctx, gvk, namespace, opts, func(page *unstructured.UnstructuredList) error {
+		for i := range page.Items {
+			if err := fn(&page.Items[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,81 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func newTestPods(n int) []runtime.Object {
+	var pods []runtime.Object
+	for i := 0; i < n; i++ {
+		tier := "web"
+		if i%2 == 1 {
+			tier = "cache"
+		}
+		pods = append(pods, &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("pod-%02d", i),
+			Namespace: "default",
+			Labels:    map[string]string{"tier": tier},
+		}})
+	}
+	return pods
+}
+
+func TestListOptions(t *testing.T) {
+	assert.Equal(t, metav1.ListOptions{}, listOptions(nil))
+	assert.Equal(t, metav1.ListOptions{LabelSelector: "app=web", Limit: 10, Continue: "abc"},
+		listOptions([]ListOptions{{LabelSelector: "app=web", Limit: 5}, {Limit: 10, Continue: "abc"}}))
+}
+
+func TestListSelectors(t *testing.T) {
+	client := newFakeCluster(newTestPods(5)...).client
+
+	pods, err := client.ListPods(context.Background(), "default", ListOptions{LabelSelector: "tier=cache"})
+	assert.Nil(t, err)
+	assert.Len(t, pods.Items, 2)
+
+	pods, err = client.ListPods(context.Background(), "default", ListOptions{LabelSelector: "tier!=cache"})
+	assert.Nil(t, err)
+	assert.Len(t, pods.Items, 3)
+}
+
+func TestListPages(t *testing.T) {
+	client := newFakeCluster(newTestPods(7)...).client
+	gvk := v1.SchemeGroupVersion.WithKind(PodKind)
+
+	var pages []int
+	err := client.ListPages(context.Background(), gvk, "default", ListOptions{Limit: 3}, func(page *unstructured.UnstructuredList) error {
+		pages = append(pages, len(page.Items))
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{3, 3, 1}, pages)
+
+	var names []string
+	err = client.ListEach(context.Background(), gvk, "", ListOptions{LabelSelector: "tier=web", Limit: 2}, func(item *unstructured.Unstructured) error {
+		names = append(names, item.GetName())
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"pod-00", "pod-02", "pod-04", "pod-06"}, names)
+
+	stop := errors.New("stop")
+	count := 0
+	err = client.ListEach(context.Background(), gvk, "default", ListOptions{Limit: 2}, func(item *unstructured.Unstructured) error {
+		count++
+		if count == 3 {
+			return stop
+		}
+		return nil
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 3, count)
+}
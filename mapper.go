@@ -0,0 +1,49 @@
+package kubernetes
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/restmapper"
+)
+
+// restMapping resolves gvk through the client's cached mapper. A kind the
+// cache does not know, e.g. one whose CRD was installed after discovery was
+// cached, invalidates the cache and is looked up once more.
+func (c *KubernetesClient) restMapping(gvk schema.GroupVersionKind) (*meta.RESTMapping, error) {
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		c.mapper.Reset()
+		mapping, err = c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	}
+	return mapping, err
+}
+
+// kindFor resolves kind the way kubectl reads it on the command line: a short
+// name ("deploy", "svc"), a resource ("deployments", "deployments.apps") or a
+// kind ("Deployment", "ServiceMonitor"). Unknown kinds refresh the cache once.
+func (c *KubernetesClient) kindFor(kind string) (schema.GroupVersionKind, error) {
+	gvk, err := c.lookupKind(kind)
+	if meta.IsNoMatchError(err) {
+		c.mapper.Reset()
+		gvk, err = c.lookupKind(kind)
+	}
+	return gvk, err
+}
+
+func (c *KubernetesClient) lookupKind(kind string) (schema.GroupVersionKind, error) {
+	mapper := restmapper.NewShortcutExpander(c.mapper, c.cacheddiscovery, nil)
+	fullySpecified, groupResource := schema.ParseResourceArg(strings.ToLower(kind))
+	if fullySpecified != nil {
+		if gvk, err := mapper.KindFor(*fullySpecified); err == nil {
+			return gvk, nil
+		}
+	}
+	return mapper.KindFor(groupResource.WithVersion(""))
+}
+
+// Refresh drops the cached discovery information, the next lookup fetches it again.
+func (c *KubernetesClient) Refresh() {
+	c.mapper.Reset()
+}
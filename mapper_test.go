@@ -0,0 +1,31 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestRestMappingRefreshesUnknownKinds(t *testing.T) {
+	cluster := newFakeCluster()
+	client, discovery := cluster.client, cluster.discovery
+
+	mapping, err := client.restMapping(schema.GroupVersionKind{Version: "v1", Kind: ConfigMapKind})
+	assert.Nil(t, err)
+	assert.Equal(t, "configmaps", mapping.Resource.Resource)
+
+	monitor := schema.GroupVersionKind{Group: "monitoring.coreos.com", Version: "v1", Kind: ServiceMonitorKind}
+	_, err = client.restMapping(monitor)
+	assert.NotNil(t, err)
+
+	// CRD installed after the cache was filled
+	discovery.Resources = append(discovery.Resources, &metav1.APIResourceList{
+		GroupVersion: "monitoring.coreos.com/v1",
+		APIResources: []metav1.APIResource{{Name: "servicemonitors", Kind: ServiceMonitorKind, Namespaced: true}},
+	})
+	mapping, err = client.restMapping(monitor)
+	assert.Nil(t, err)
+	assert.Equal(t, "servicemonitors", mapping.Resource.Resource)
+}
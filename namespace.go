@@ -0,0 +1,470 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// ProtectedNamespaceLabel set to "true" makes DeleteNamespace refuse to delete the namespace.
+const ProtectedNamespaceLabel = "cg-controller/protected"
+
+const finalizeTimeout = 30 * time.Second
+
+// ErrNamespaceProtected is wrapped by the error of DeleteNamespace on a protected namespace.
+var ErrNamespaceProtected = errors.New("namespace is protected")
+
+// NamespaceProfile is what CreateNamespaceWithProfile sets up in a namespace.
+// Every object it creates is named after the namespace, nil parts are skipped.
+type NamespaceProfile struct {
+	Labels      map[string]string
+	Annotations map[string]string
+
+	Quota                v1.ResourceList // ResourceQuota hard limits
+	LimitDefaults        v1.ResourceList // LimitRange default limits per container
+	LimitDefaultRequests v1.ResourceList // LimitRange default requests per container
+
+	NetworkPolicy *netv1.NetworkPolicySpec // e.g. SameNamespaceOnlyPolicy()
+	RoleBinding   *NamespaceRoleBinding
+}
+
+// NamespaceRoleBinding grants ClusterRole, e.g. "edit", to Subjects inside the namespace.
+type NamespaceRoleBinding struct {
+	ClusterRole string
+	Subjects    []rbacv1.Subject
+}
+
+// DefaultNamespaceProfile is the quota CreateNamespace always used.
+func DefaultNamespaceProfile() NamespaceProfile {
+	return NamespaceProfile{
+		Quota: v1.ResourceList{
+			v1.ResourceLimitsCPU:      resource.MustParse("128000m"),
+			v1.ResourceLimitsMemory:   resource.MustParse("200Gi"),
+			v1.ResourceRequestsCPU:    resource.MustParse("128000m"),
+			v1.ResourceRequestsMemory: resource.MustParse("150Gi"),
+		},
+	}
+}
+
+// SameNamespaceOnlyPolicy lets pods receive traffic from pods of their own namespace only.
+func SameNamespaceOnlyPolicy() *netv1.NetworkPolicySpec {
+	return &netv1.NetworkPolicySpec{
+		PodSelector: metav1.LabelSelector{},
+		PolicyTypes: []netv1.PolicyType{netv1.PolicyTypeIngress},
+		Ingress:     []netv1.NetworkPolicyIngressRule{{From: []netv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{}}}}},
+	}
+}
+
+// CreateNamespaceWithProfile creates the namespace and the objects of profile.
+// It is idempotent: existing objects are updated to match the profile and
+// labels and annotations are added to an existing namespace.
+func (c *KubernetesClient) CreateNamespaceWithProfile(ctx context.Context, name string, profile NamespaceProfile) (*v1.Namespace, error) {
+	namespace, err := c.ensureNamespace(ctx, name, profile)
+	if err != nil {
+		return nil, err
+	}
+	if profile.Quota != nil {
+		if err := c.ensureResourceQuota(ctx, name, profile.Quota); err != nil {
+			return nil, err
+		}
+	}
+	if profile.LimitDefaults != nil || profile.LimitDefaultRequests != nil {
+		if err := c.ensureLimitRange(ctx, name, profile); err != nil {
+			return nil, err
+		}
+	}
+	if profile.NetworkPolicy != nil {
+		if err := c.ensureNetworkPolicy(ctx, name, *profile.NetworkPolicy); err != nil {
+			return nil, err
+		}
+	}
+	if profile.RoleBinding != nil {
+		if err := c.ensureRoleBinding(ctx, name, *profile.RoleBinding); err != nil {
+			return nil, err
+		}
+	}
+	return namespace, nil
+}
+
+func (c *KubernetesClient) ensureNamespace(ctx context.Context, name string, profile NamespaceProfile) (*v1.Namespace, error) {
+	namespaces := c.clientset.CoreV1().Namespaces()
+	gvk := v1.SchemeGroupVersion.WithKind(NamespaceKind)
+
+	namespace, err := namespaces.Get(ctx, name, metav1.GetOptions{})
+	if IsNotFound(err) {
+		namespace, err = namespaces.Create(ctx, &v1.Namespace{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: NamespaceKind},
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: profile.Labels, Annotations: profile.Annotations},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return nil, objectError("create", gvk, "", name, err)
+		}
+		fmt.Printf("Created namespace %s\n", name)
+		return namespace, nil
+	}
+	if err != nil {
+		return nil, objectError("get", gvk, "", name, err)
+	}
+
+	changed := false
+	for k, v := range profile.Labels {
+		if namespace.Labels[k] != v {
+			namespace.Labels = setKey(namespace.Labels, k, v)
+			changed = true
+		}
+	}
+	for k, v := range profile.Annotations {
+		if namespace.Annotations[k] != v {
+			namespace.Annotations = setKey(namespace.Annotations, k, v)
+			changed = true
+		}
+	}
+	if !changed {
+		return namespace, nil
+	}
+	namespace, err = namespaces.Update(ctx, namespace, metav1.UpdateOptions{})
+	return namespace, objectError("update", gvk, "", name, err)
+}
+
+func (c *KubernetesClient) ensureResourceQuota(ctx context.Context, namespace string, hard v1.ResourceList) error {
+	quotas := c.clientset.CoreV1().ResourceQuotas(namespace)
+	gvk := v1.SchemeGroupVersion.WithKind("ResourceQuota")
+
+	quota, err := quotas.Get(ctx, namespace, metav1.GetOptions{})
+	if IsNotFound(err) {
+		_, err = quotas.Create(ctx, &v1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: namespace, Namespace: namespace},
+			Spec:       v1.ResourceQuotaSpec{Hard: hard},
+		}, metav1.CreateOptions{})
+		return objectError("create", gvk, namespace, namespace, err)
+	}
+	if err != nil {
+		return objectError("get", gvk, namespace, namespace, err)
+	}
+	quota.Spec.Hard = hard
+	_, err = quotas.Update(ctx, quota, metav1.UpdateOptions{})
+	return objectError("update", gvk, namespace, namespace, err)
+}
+
+func (c *KubernetesClient) ensureLimitRange(ctx context.Context, namespace string, profile NamespaceProfile) error {
+	limitRanges := c.clientset.CoreV1().LimitRanges(namespace)
+	gvk := v1.SchemeGroupVersion.WithKind("LimitRange")
+	spec := v1.LimitRangeSpec{Limits: []v1.LimitRangeItem{{
+		Type:           v1.LimitTypeContainer,
+		Default:        profile.LimitDefaults,
+		DefaultRequest: profile.LimitDefaultRequests,
+	}}}
+
+	limitRange, err := limitRanges.Get(ctx, namespace, metav1.GetOptions{})
+	if IsNotFound(err) {
+		_, err = limitRanges.Create(ctx, &v1.LimitRange{
+			ObjectMeta: metav1.ObjectMeta{Name: namespace, Namespace: namespace},
+			Spec:       spec,
+		}, metav1.CreateOptions{})
+		return objectError("create", gvk, namespace, namespace, err)
+	}
+	if err != nil {
+		return objectError("get", gvk, namespace, namespace, err)
+	}
+	limitRange.Spec = spec
+	_, err = limitRanges.Update(ctx, limitRange, metav1.UpdateOptions{})
+	return objectError("update", gvk, namespace, namespace, err)
+}
+
+func (c *KubernetesClient) ensureNetworkPolicy(ctx context.Context, namespace string, spec netv1.NetworkPolicySpec) error {
+	policies := c.clientset.NetworkingV1().NetworkPolicies(namespace)
+	gvk := netv1.SchemeGroupVersion.WithKind("NetworkPolicy")
+
+	policy, err := policies.Get(ctx, namespace, metav1.GetOptions{})
+	if IsNotFound(err) {
+		_, err = policies.Create(ctx, &netv1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: namespace, Namespace: namespace},
+			Spec:       spec,
+		}, metav1.CreateOptions{})
+		return objectError("create", gvk, namespace, namespace, err)
+	}
+	if err != nil {
+		return objectError("get", gvk, namespace, namespace, err)
+	}
+	policy.Spec = spec
+	_, err = policies.Update(ctx, policy, metav1.UpdateOptions{})
+	return objectError("update", gvk, namespace, namespace, err)
+}
+
+func (c *KubernetesClient) ensureRoleBinding(ctx context.Context, namespace string, binding NamespaceRoleBinding) error {
+	roleBindings := c.clientset.RbacV1().RoleBindings(namespace)
+	gvk := rbacv1.SchemeGroupVersion.WithKind("RoleBinding")
+	roleRef := rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: binding.ClusterRole}
+
+	roleBinding, err := roleBindings.Get(ctx, namespace, metav1.GetOptions{})
+	if IsNotFound(err) {
+		_, err = roleBindings.Create(ctx, &rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: namespace, Namespace: namespace},
+			RoleRef:    roleRef,
+			Subjects:   binding.Subjects,
+		}, metav1.CreateOptions{})
+		return objectError("create", gvk, namespace, namespace, err)
+	}
+	if err != nil {
+		return objectError("get", gvk, namespace, namespace, err)
+	}
+	if roleBinding.RoleRef != roleRef {
+		// the role of a binding cannot change, it has to be replaced
+		if err := roleBindings.Delete(ctx, namespace, metav1.DeleteOptions{}); err != nil {
+			return objectError("delete", gvk, namespace, namespace, err)
+		}
+		return c.ensureRoleBinding(ctx, namespace, binding)
+	}
+	roleBinding.Subjects = binding.Subjects
+	_, err = roleBindings.Update(ctx, roleBinding, metav1.UpdateOptions{})
+	return objectError("update", gvk, namespace, namespace, err)
+}
+
+// ResourceUsage is the use of one resource against the tightest quota limiting it.
+type ResourceUsage struct {
+	Resource v1.ResourceName
+	Quota    string // name of the ResourceQuota
+	Used     resource.Quantity
+	Hard     resource.Quantity
+}
+
+// Percent of Hard in use, 0 when Hard is zero.
+func (u ResourceUsage) Percent() float64 {
+	if u.Hard.IsZero() {
+		return 0
+	}
+	return float64(u.Used.MilliValue()) / float64(u.Hard.MilliValue()) * 100
+}
+
+type NamespaceUsage struct {
+	Namespace string
+	Resources []ResourceUsage // sorted by resource name
+}
+
+func (u NamespaceUsage) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "namespace %s", u.Namespace)
+	for _, r := range u.Resources {
+		fmt.Fprintf(&b, "\n  %s: %s of %s (%.0f%%)", r.Resource, r.Used.String(), r.Hard.String(), r.Percent())
+	}
+	return b.String()
+}
+
+// GetNamespaceUsage reports usage against the quotas of namespace as the
+// quota controller last observed it. A resource limited by several quotas is
+// reported against the one with the lowest limit.
+func (c *KubernetesClient) GetNamespaceUsage(ctx context.Context, namespace string) (*NamespaceUsage, error) {
+	quotas, err := c.clientset.CoreV1().ResourceQuotas(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, objectError("list", v1.SchemeGroupVersion.WithKind("ResourceQuota"), namespace, "", err)
+	}
+
+	usage := map[v1.ResourceName]ResourceUsage{}
+	for _, quota := range quotas.Items {
+		for name, hard := range quota.Status.Hard {
+			if current, ok := usage[name]; ok && current.Hard.Cmp(hard) <= 0 {
+				continue
+			}
+			usage[name] = ResourceUsage{Resource: name, Quota: quota.Name, Used: quota.Status.Used[name], Hard: hard}
+		}
+	}
+
+	report := &NamespaceUsage{Namespace: namespace}
+	for _, r := range usage {
+		report.Resources = append(report.Resources, r)
+	}
+	sort.Slice(report.Resources, func(i, j int) bool { return report.Resources[i].Resource < report.Resources[j].Resource })
+	return report, nil
+}
+
+// DeleteNamespaceOptions are the optional settings of DeleteNamespace.
+type DeleteNamespaceOptions struct {
+	// Wait until the namespace is gone or ctx is done. A namespace still
+	// terminating then fails with a *NamespaceStuckError.
+	Wait bool
+	// ForceFinalize clears the finalizers of a namespace still terminating
+	// when the wait ends, so the API server removes it at once. Objects left
+	// in the namespace are not cleaned up by their controllers. Implies Wait.
+	ForceFinalize bool
+}
+
+// NamespaceTerminationReport explains what keeps a namespace in Terminating.
+type NamespaceTerminationReport struct {
+	Namespace        string
+	Phase            v1.NamespacePhase
+	Finalizers       []string // finalizers of the namespace, e.g. "kubernetes"
+	Conditions       []string // e.g. "NamespaceContentRemaining: Some resources are remaining: pods. has 1 resource instances"
+	Remaining        []string // e.g. "pods: 3", by resource
+	ObjectFinalizers []string // e.g. "pods/web-0: example.com/drain", objects held by a finalizer
+}
+
+func (r NamespaceTerminationReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "namespace %s is %s", r.Namespace, r.Phase)
+	if len(r.Finalizers) > 0 {
+		fmt.Fprintf(&b, "\n  finalizers: %s", strings.Join(r.Finalizers, ", "))
+	}
+	for _, condition := range r.Conditions {
+		fmt.Fprintf(&b, "\n  condition %s", condition)
+	}
+	for _, remaining := range r.Remaining {
+		fmt.Fprintf(&b, "\n  remaining %s", remaining)
+	}
+	for _, finalizers := range r.ObjectFinalizers {
+		fmt.Fprintf(&b, "\n  blocked %s", finalizers)
+	}
+	return b.String()
+}
+
+type NamespaceStuckError struct {
+	Report NamespaceTerminationReport
+	Err    error
+}
+
+func (e *NamespaceStuckError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Report.String(), e.Err)
+}
+
+func (e *NamespaceStuckError) Unwrap() error {
+	return e.Err
+}
+
+// DeleteNamespace deletes name unless it carries ProtectedNamespaceLabel.
+// Without options it returns as soon as the deletion is accepted.
+func (c *KubernetesClient) DeleteNamespace(ctx context.Context, name string, opts ...DeleteNamespaceOptions) error {
+	var options DeleteNamespaceOptions
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	namespaces := c.clientset.CoreV1().Namespaces()
+	gvk := v1.SchemeGroupVersion.WithKind(NamespaceKind)
+
+	namespace, err := namespaces.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return objectError("delete", gvk, "", name, err)
+	}
+	if namespace.Labels[ProtectedNamespaceLabel] == "true" {
+		return objectError("delete", gvk, "", name, fmt.Errorf("%w, remove label %s first", ErrNamespaceProtected, ProtectedNamespaceLabel))
+	}
+
+	var gracePeriodSeconds = int64(0)
+	err = namespaces.Delete(ctx, name, metav1.DeleteOptions{GracePeriodSeconds: &gracePeriodSeconds})
+	if err != nil || !(options.Wait || options.ForceFinalize) {
+		return objectError("delete", gvk, "", name, err)
+	}
+
+	err = c.waitNamespaceGone(ctx, name)
+	if err == nil {
+		fmt.Printf("Deleted namespace %s\n", name)
+		return nil
+	}
+	if !wait.Interrupted(err) {
+		return objectError("wait", gvk, "", name, err)
+	}
+
+	// ctx is done, the report and the force-finalize get their own timeout
+	reportCtx, cancel := context.WithTimeout(context.Background(), finalizeTimeout)
+	defer cancel()
+	report := c.namespaceTerminationReport(reportCtx, name)
+	if !options.ForceFinalize {
+		return &NamespaceStuckError{Report: report, Err: err}
+	}
+
+	fmt.Printf("Force-finalizing %s\n", report.String())
+	if err := c.finalizeNamespace(reportCtx, name); err != nil {
+		return &NamespaceStuckError{Report: report, Err: objectError("finalize", gvk, "", name, err)}
+	}
+	if err := c.waitNamespaceGone(reportCtx, name); err != nil {
+		return &NamespaceStuckError{Report: report, Err: err}
+	}
+	fmt.Printf("Deleted namespace %s\n", name)
+	return nil
+}
+
+func (c *KubernetesClient) waitNamespaceGone(ctx context.Context, name string) error {
+	return wait.PollUntilContextCancel(ctx, readyPollInterval, true, func(ctx context.Context) (bool, error) {
+		_, err := c.clientset.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+		if IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+}
+
+// finalizeNamespace empties spec.finalizers through the finalize subresource.
+func (c *KubernetesClient) finalizeNamespace(ctx context.Context, name string) error {
+	namespace, err := c.clientset.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+	if IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	namespace.Spec.Finalizers = nil
+	_, err = c.clientset.CoreV1().Namespaces().Finalize(ctx, namespace, metav1.UpdateOptions{})
+	return err
+}
+
+// namespaceTerminationReport collects what is left of a terminating
+// namespace. It is best effort, resources that cannot be listed are skipped.
+func (c *KubernetesClient) namespaceTerminationReport(ctx context.Context, name string) NamespaceTerminationReport {
+	report := NamespaceTerminationReport{Namespace: name}
+	namespace, err := c.clientset.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		report.Conditions = append(report.Conditions, err.Error())
+		return report
+	}
+	report.Phase = namespace.Status.Phase
+	for _, finalizer := range namespace.Spec.Finalizers {
+		report.Finalizers = append(report.Finalizers, string(finalizer))
+	}
+	report.Finalizers = append(report.Finalizers, namespace.Finalizers...)
+	for _, condition := range namespace.Status.Conditions {
+		if condition.Status == v1.ConditionTrue {
+			report.Conditions = append(report.Conditions, fmt.Sprintf("%s: %s", condition.Type, condition.Message))
+		}
+	}
+
+	resources, err := c.cacheddiscovery.ServerPreferredNamespacedResources()
+	if err != nil && len(resources) == 0 {
+		report.Conditions = append(report.Conditions, fmt.Sprintf("discovery: %v", err))
+		return report
+	}
+	for _, list := range resources {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			continue
+		}
+		for _, r := range list.APIResources {
+			if len(r.Verbs) > 0 && !sets.New(r.Verbs...).Has("list") {
+				continue
+			}
+			resource := gv.WithResource(r.Name).GroupResource().String()
+			objects, err := c.dynamicinterface.Resource(gv.WithResource(r.Name)).Namespace(name).List(ctx, metav1.ListOptions{})
+			if err != nil || len(objects.Items) == 0 {
+				continue
+			}
+			report.Remaining = append(report.Remaining, fmt.Sprintf("%s: %d", resource, len(objects.Items)))
+			for _, obj := range objects.Items {
+				if finalizers := obj.GetFinalizers(); len(finalizers) > 0 {
+					report.ObjectFinalizers = append(report.ObjectFinalizers, fmt.Sprintf("%s/%s: %s", resource, obj.GetName(), strings.Join(finalizers, ", ")))
+				}
+			}
+		}
+	}
+	sort.Strings(report.Remaining)
+	sort.Strings(report.ObjectFinalizers)
+	return report
+}
@@ -0,0 +1,185 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ktesting "k8s.io/client-go/testing"
+)
+
+func TestCreateNamespaceWithProfile(t *testing.T) {
+	cluster := newFakeCluster()
+	client := cluster.client
+	ctx := context.Background()
+	profile := NamespaceProfile{
+		Labels:               map[string]string{"team": "payments"},
+		Annotations:          map[string]string{"owner": "payments@example.com"},
+		Quota:                v1.ResourceList{v1.ResourceRequestsCPU: resource.MustParse("4"), v1.ResourcePods: resource.MustParse("20")},
+		LimitDefaults:        v1.ResourceList{v1.ResourceMemory: resource.MustParse("512Mi")},
+		LimitDefaultRequests: v1.ResourceList{v1.ResourceMemory: resource.MustParse("256Mi")},
+		NetworkPolicy:        SameNamespaceOnlyPolicy(),
+		RoleBinding: &NamespaceRoleBinding{
+			ClusterRole: "edit",
+			Subjects:    []rbacv1.Subject{{Kind: rbacv1.GroupKind, APIGroup: rbacv1.GroupName, Name: "payments"}},
+		},
+	}
+
+	namespace, err := client.CreateNamespaceWithProfile(ctx, "payments", profile)
+	assert.Nil(t, err)
+	assert.Equal(t, "payments", namespace.Labels["team"])
+
+	quota, err := cluster.clientset.CoreV1().ResourceQuotas("payments").Get(ctx, "payments", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "20", quota.Spec.Hard.Pods().String())
+	limitRange, err := cluster.clientset.CoreV1().LimitRanges("payments").Get(ctx, "payments", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "512Mi", limitRange.Spec.Limits[0].Default.Memory().String())
+	_, err = cluster.clientset.NetworkingV1().NetworkPolicies("payments").Get(ctx, "payments", metav1.GetOptions{})
+	assert.Nil(t, err)
+	roleBinding, err := cluster.clientset.RbacV1().RoleBindings("payments").Get(ctx, "payments", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "edit", roleBinding.RoleRef.Name)
+
+	// a second run updates what changed
+	profile.Labels = map[string]string{"tier": "gold"}
+	profile.Quota = v1.ResourceList{v1.ResourcePods: resource.MustParse("50")}
+	profile.RoleBinding.ClusterRole = "admin"
+	namespace, err = client.CreateNamespaceWithProfile(ctx, "payments", profile)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"team": "payments", "tier": "gold"}, namespace.Labels)
+	quota, err = cluster.clientset.CoreV1().ResourceQuotas("payments").Get(ctx, "payments", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "50", quota.Spec.Hard.Pods().String())
+	roleBinding, err = cluster.clientset.RbacV1().RoleBindings("payments").Get(ctx, "payments", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "admin", roleBinding.RoleRef.Name)
+}
+
+func TestGetNamespaceUsage(t *testing.T) {
+	client := newFakeCluster(
+		&v1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: "compute", Namespace: "payments"},
+			Status: v1.ResourceQuotaStatus{
+				Hard: v1.ResourceList{v1.ResourceRequestsCPU: resource.MustParse("4"), v1.ResourcePods: resource.MustParse("20")},
+				Used: v1.ResourceList{v1.ResourceRequestsCPU: resource.MustParse("1500m"), v1.ResourcePods: resource.MustParse("5")},
+			},
+		},
+		&v1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: "pods", Namespace: "payments"},
+			Status: v1.ResourceQuotaStatus{
+				Hard: v1.ResourceList{v1.ResourcePods: resource.MustParse("10")},
+				Used: v1.ResourceList{v1.ResourcePods: resource.MustParse("5")},
+			},
+		},
+	).client
+
+	usage, err := client.GetNamespaceUsage(context.Background(), "payments")
+	assert.Nil(t, err)
+	assert.Len(t, usage.Resources, 2)
+	pods := usage.Resources[0]
+	assert.Equal(t, v1.ResourcePods, pods.Resource)
+	assert.Equal(t, "pods", pods.Quota)
+	assert.Equal(t, float64(50), pods.Percent())
+	cpu := usage.Resources[1]
+	assert.Equal(t, v1.ResourceRequestsCPU, cpu.Resource)
+	assert.Equal(t, 37.5, cpu.Percent())
+	assert.Contains(t, usage.String(), "requests.cpu: 1500m of 4 (38%)")
+}
+
+func TestDeleteNamespaceProtected(t *testing.T) {
+	client := newFakeCluster(&v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "prod", Labels: map[string]string{ProtectedNamespaceLabel: "true"}},
+	}).client
+	ctx := context.Background()
+
+	err := client.DeleteNamespace(ctx, "prod")
+	assert.ErrorIs(t, err, ErrNamespaceProtected)
+	_, err = client.clientset.CoreV1().Namespaces().Get(ctx, "prod", metav1.GetOptions{})
+	assert.Nil(t, err)
+}
+
+func TestDeleteNamespaceWait(t *testing.T) {
+	client := newFakeCluster(&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "cg"}}).client
+	assert.Nil(t, client.DeleteNamespace(context.Background(), "cg", DeleteNamespaceOptions{Wait: true}))
+}
+
+// newStuckNamespaceCluster has a namespace that stays Terminating on delete,
+// like one whose content cannot be removed, until it is finalized.
+func newStuckNamespaceCluster() *fakeCluster {
+	cluster := newFakeCluster(
+		&v1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: "stuck"},
+			Spec:       v1.NamespaceSpec{Finalizers: []v1.FinalizerName{v1.FinalizerKubernetes}},
+			Status:     v1.NamespaceStatus{Phase: v1.NamespaceActive},
+		},
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-0", Namespace: "stuck", Finalizers: []string{"example.com/drain"}}},
+	)
+	tracker := cluster.clientset.Tracker()
+	namespaces := v1.SchemeGroupVersion.WithResource("namespaces")
+
+	cluster.clientset.PrependReactor("delete", "namespaces", func(action ktesting.Action) (bool, runtime.Object, error) {
+		name := action.(ktesting.DeleteAction).GetName()
+		obj, err := tracker.Get(namespaces, "", name)
+		if err != nil {
+			return true, nil, err
+		}
+		namespace := obj.(*v1.Namespace)
+		now := metav1.Now()
+		namespace.DeletionTimestamp = &now
+		namespace.Status.Phase = v1.NamespaceTerminating
+		namespace.Status.Conditions = []v1.NamespaceCondition{{
+			Type: v1.NamespaceFinalizersRemaining, Status: v1.ConditionTrue,
+			Message: "Some content in the namespace has finalizers remaining: example.com/drain in 1 resource instances",
+		}}
+		return true, nil, tracker.Update(namespaces, namespace, "")
+	})
+	cluster.clientset.PrependReactor("create", "namespaces", func(action ktesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "finalize" {
+			return false, nil, nil
+		}
+		namespace := action.(ktesting.CreateAction).GetObject().(*v1.Namespace)
+		if len(namespace.Spec.Finalizers) > 0 {
+			return true, nil, tracker.Update(namespaces, namespace, "")
+		}
+		return true, namespace, tracker.Delete(namespaces, "", namespace.Name)
+	})
+	return cluster
+}
+
+func TestDeleteNamespaceStuck(t *testing.T) {
+	client := newStuckNamespaceCluster().client
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := client.DeleteNamespace(ctx, "stuck", DeleteNamespaceOptions{Wait: true})
+	var stuck *NamespaceStuckError
+	assert.ErrorAs(t, err, &stuck)
+	report := stuck.Report
+	assert.Equal(t, v1.NamespaceTerminating, report.Phase)
+	assert.Equal(t, []string{"kubernetes"}, report.Finalizers)
+	assert.Len(t, report.Conditions, 1)
+	assert.Equal(t, []string{"pods: 1"}, report.Remaining)
+	assert.Equal(t, []string{"pods/web-0: example.com/drain"}, report.ObjectFinalizers)
+	assert.Contains(t, err.Error(), "namespace stuck is Terminating")
+
+	// the namespace is left alone without ForceFinalize
+	_, err = client.clientset.CoreV1().Namespaces().Get(context.Background(), "stuck", metav1.GetOptions{})
+	assert.Nil(t, err)
+}
+
+func TestDeleteNamespaceForceFinalize(t *testing.T) {
+	client := newStuckNamespaceCluster().client
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	assert.Nil(t, client.DeleteNamespace(ctx, "stuck", DeleteNamespaceOptions{ForceFinalize: true}))
+	_, err := client.clientset.CoreV1().Namespaces().Get(context.Background(), "stuck", metav1.GetOptions{})
+	assert.True(t, IsNotFound(err))
+}
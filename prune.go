@@ -0,0 +1,89 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// DefaultPruneKinds are the kinds pruned when ApplyOptions.PruneKinds is empty.
+// Namespaces, volumes and CRDs are left out on purpose, deleting them loses data.
+var DefaultPruneKinds = []schema.GroupKind{
+	{Kind: ConfigMapKind},
+	{Kind: SecretKind},
+	{Kind: ServiceKind},
+	{Kind: ServiceAccountKind},
+	{Kind: "Endpoints"},
+	{Group: "apps", Kind: DeploymentKind},
+	{Group: "apps", Kind: StatefulSetKind},
+	{Group: "apps", Kind: DaemonSetKind},
+	{Group: "batch", Kind: JobKind},
+	{Group: "batch", Kind: "CronJob"},
+	{Group: "networking.k8s.io", Kind: IngressKind},
+	{Group: "extensions", Kind: IngressKind},
+	{Group: "rbac.authorization.k8s.io", Kind: RoleKind},
+	{Group: "rbac.authorization.k8s.io", Kind: RoleBindingKind},
+}
+
+var errPruneNeedsRelease = errors.New("prune needs a release to compare against")
+
+// prune deletes the objects of the previous revision of the release that are
+// not in applied. Only allowed kinds are deleted, on dry runs the server only
+// validates the deletions.
+func (c *KubernetesClient) prune(ctx context.Context, releaseNamespace string, applied []ObjectRef, opts ApplyOptions) ([]ApplyResult, error) {
+	previous, err := c.GetRelease(ctx, releaseNamespace, opts.Release)
+	if IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := opts.PruneKinds
+	if len(allowed) == 0 {
+		allowed = DefaultPruneKinds
+	}
+	allowedKinds := map[schema.GroupKind]struct{}{}
+	for _, gk := range allowed {
+		allowedKinds[gk] = struct{}{}
+	}
+	current := map[ObjectRef]struct{}{}
+	for _, ref := range applied {
+		current[unversioned(ref)] = struct{}{}
+	}
+
+	var stale []ObjectRef
+	for _, ref := range previous.Objects {
+		if _, ok := current[unversioned(ref)]; ok {
+			continue
+		}
+		if _, ok := allowedKinds[ref.GroupVersionKind().GroupKind()]; !ok {
+			fmt.Printf("Not pruning %s, kind is not allowed \n", ref)
+			continue
+		}
+		stale = append(stale, ref)
+	}
+	sort.SliceStable(stale, func(i, j int) bool {
+		return installOrderIndex(stale[i].Kind) > installOrderIndex(stale[j].Kind)
+	})
+
+	var pruned []ApplyResult
+	for _, ref := range stale {
+		err := c.deleteRef(ctx, ref, opts.DryRun)
+		if IsNotFound(err) {
+			err = nil
+		}
+		pruned = append(pruned, ApplyResult{GVK: ref.GroupVersionKind(), Namespace: ref.Namespace, Name: ref.Name, Err: err})
+	}
+	return pruned, nil
+}
+
+// unversioned drops the version so an object keeps its identity when a
+// manifest moves it to another API version.
+func unversioned(ref ObjectRef) ObjectRef {
+	ref.Version = ""
+	return ref
+}
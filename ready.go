@@ -0,0 +1,292 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	readyPollInterval  = 2 * time.Second
+	diagnosticsTimeout = 10 * time.Second
+	diagnosticsEvents  = 5
+)
+
+type PodDiagnostic struct {
+	Name    string
+	Phase   v1.PodPhase
+	Reasons []string // e.g. "nginx: ImagePullBackOff: Back-off pulling image"
+}
+
+// ReadinessReport explains why an object did not become ready in time.
+type ReadinessReport struct {
+	GVK         schema.GroupVersionKind
+	Namespace   string
+	Name        string
+	Reason      string // last observed reason the object was not ready
+	FailingPods []PodDiagnostic
+	Events      []string // last events of the object and its failing pods
+}
+
+func (r ReadinessReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s/%s not ready: %s", r.GVK.Kind, r.Namespace, r.Name, r.Reason)
+	for _, pod := range r.FailingPods {
+		fmt.Fprintf(&b, "\n  pod %s (%s): %s", pod.Name, pod.Phase, strings.Join(pod.Reasons, ", "))
+	}
+	for _, event := range r.Events {
+		fmt.Fprintf(&b, "\n  event %s", event)
+	}
+	return b.String()
+}
+
+type NotReadyError struct {
+	Report ReadinessReport
+	Err    error
+}
+
+func (e *NotReadyError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Report.String(), e.Err)
+}
+
+func (e *NotReadyError) Unwrap() error {
+	return e.Err
+}
+
+// WaitForReady polls the object until it is ready or ctx is done. Deployments,
+// StatefulSets, DaemonSets, Jobs, Services and Ingresses are understood.
+// Failed reads are retried with the next poll. When it gives up the returned
+// *NotReadyError carries a diagnostic summary.
+func (c *KubernetesClient) WaitForReady(ctx context.Context, gvk schema.GroupVersionKind, namespace string, name string) error {
+	mapping, err := c.restMapping(gvk)
+	if err != nil {
+		return objectError("wait", gvk, namespace, name, err)
+	}
+	dr := c.resourceInterface(mapping, namespace)
+
+	reason := "not found"
+	var selector *metav1.LabelSelector
+	err = wait.PollUntilContextCancel(ctx, readyPollInterval, true, func(ctx context.Context) (bool, error) {
+		obj, err := dr.Get(ctx, name, metav1.GetOptions{})
+		if IsNotFound(err) {
+			reason = "not found"
+			return false, nil
+		}
+		if err != nil {
+			// e.g. throttling or a timeout, the next poll may get through
+			reason = fmt.Sprintf("get failed: %v", err)
+			return false, nil
+		}
+		var ready bool
+		ready, reason, selector, err = c.checkReady(ctx, obj)
+		return ready, err
+	})
+	if err == nil {
+		fmt.Printf("%s %s/%s is ready\n", gvk.Kind, namespace, name)
+		return nil
+	}
+	if !wait.Interrupted(err) && !errors.Is(err, errJobFailed) {
+		return objectError("wait", gvk, namespace, name, err)
+	}
+
+	report := ReadinessReport{GVK: gvk, Namespace: namespace, Name: name, Reason: reason}
+	c.diagnose(&report, selector)
+	return &NotReadyError{Report: report, Err: err}
+}
+
+var errJobFailed = errors.New("job failed")
+
+// checkReady reports readiness, the reason when not ready and the selector of
+// the pods backing the object.
+func (c *KubernetesClient) checkReady(ctx context.Context, obj *unstructured.Unstructured) (bool, string, *metav1.LabelSelector, error) {
+	switch o := toTyped(obj).(type) {
+	case *appsv1.Deployment:
+		replicas := replicasOf(o.Spec.Replicas)
+		switch {
+		case o.Status.ObservedGeneration < o.Generation:
+			return false, "rollout not observed yet", o.Spec.Selector, nil
+		case o.Status.UpdatedReplicas < replicas:
+			return false, fmt.Sprintf("%d of %d replicas updated", o.Status.UpdatedReplicas, replicas), o.Spec.Selector, nil
+		case o.Status.Replicas > o.Status.UpdatedReplicas:
+			return false, fmt.Sprintf("%d old replicas pending termination", o.Status.Replicas-o.Status.UpdatedReplicas), o.Spec.Selector, nil
+		case o.Status.AvailableReplicas < replicas:
+			return false, fmt.Sprintf("%d of %d replicas available", o.Status.AvailableReplicas, replicas), o.Spec.Selector, nil
+		}
+		return true, "", o.Spec.Selector, nil
+	case *appsv1.StatefulSet:
+		replicas := replicasOf(o.Spec.Replicas)
+		switch {
+		case o.Status.ObservedGeneration < o.Generation:
+			return false, "rollout not observed yet", o.Spec.Selector, nil
+		case o.Status.ReadyReplicas < replicas:
+			return false, fmt.Sprintf("%d of %d replicas ready", o.Status.ReadyReplicas, replicas), o.Spec.Selector, nil
+		case o.Spec.UpdateStrategy.Type != appsv1.OnDeleteStatefulSetStrategyType && o.Status.UpdateRevision != o.Status.CurrentRevision:
+			return false, fmt.Sprintf("revision %s not rolled out", o.Status.UpdateRevision), o.Spec.Selector, nil
+		}
+		return true, "", o.Spec.Selector, nil
+	case *appsv1.DaemonSet:
+		desired := o.Status.DesiredNumberScheduled
+		switch {
+		case o.Status.ObservedGeneration < o.Generation:
+			return false, "rollout not observed yet", o.Spec.Selector, nil
+		case o.Status.UpdatedNumberScheduled < desired:
+			return false, fmt.Sprintf("%d of %d pods updated", o.Status.UpdatedNumberScheduled, desired), o.Spec.Selector, nil
+		case o.Status.NumberAvailable < desired:
+			return false, fmt.Sprintf("%d of %d pods available", o.Status.NumberAvailable, desired), o.Spec.Selector, nil
+		}
+		return true, "", o.Spec.Selector, nil
+	case *batchv1.Job:
+		for _, condition := range o.Status.Conditions {
+			if condition.Status != v1.ConditionTrue {
+				continue
+			}
+			switch condition.Type {
+			case batchv1.JobComplete:
+				return true, "", o.Spec.Selector, nil
+			case batchv1.JobFailed:
+				reason := fmt.Sprintf("%s: %s", condition.Reason, condition.Message)
+				return false, reason, o.Spec.Selector, fmt.Errorf("%w: %s", errJobFailed, reason)
+			}
+		}
+		return false, fmt.Sprintf("%d active, %d succeeded, %d failed", o.Status.Active, o.Status.Succeeded, o.Status.Failed), o.Spec.Selector, nil
+	case *v1.Service:
+		return c.checkServiceReady(ctx, o)
+	}
+
+	if obj.GetKind() == IngressKind {
+		ingress, _, _ := unstructured.NestedSlice(obj.Object, "status", "loadBalancer", "ingress")
+		if len(ingress) == 0 {
+			return false, "no load balancer address yet", nil, nil
+		}
+		return true, "", nil, nil
+	}
+	return false, "", nil, fmt.Errorf("readiness of kind %s is not supported", obj.GetKind())
+}
+
+func (c *KubernetesClient) checkServiceReady(ctx context.Context, service *v1.Service) (bool, string, *metav1.LabelSelector, error) {
+	var selector *metav1.LabelSelector
+	if len(service.Spec.Selector) > 0 {
+		selector = &metav1.LabelSelector{MatchLabels: service.Spec.Selector}
+	}
+
+	switch service.Spec.Type {
+	case v1.ServiceTypeExternalName:
+		return true, "", nil, nil
+	case v1.ServiceTypeLoadBalancer:
+		if len(service.Status.LoadBalancer.Ingress) == 0 {
+			return false, "no load balancer address yet", selector, nil
+		}
+	}
+
+	endpoints, err := c.clientset.CoreV1().Endpoints(service.Namespace).Get(ctx, service.Name, metav1.GetOptions{})
+	if IsNotFound(err) {
+		return false, "no endpoints yet", selector, nil
+	}
+	if err != nil {
+		return false, "", selector, err
+	}
+	for _, subset := range endpoints.Subsets {
+		if len(subset.Addresses) > 0 {
+			return true, "", selector, nil
+		}
+	}
+	return false, "no ready endpoint addresses", selector, nil
+}
+
+// diagnose fills in failing pods and recent events. The wait context is
+// usually done by now, so it runs on its own short timeout.
+func (c *KubernetesClient) diagnose(report *ReadinessReport, selector *metav1.LabelSelector) {
+	ctx, cancel := context.WithTimeout(context.Background(), diagnosticsTimeout)
+	defer cancel()
+
+	report.Events = append(report.Events, c.lastEvents(ctx, report.Namespace, report.Name)...)
+	if selector == nil {
+		return
+	}
+	labelSelector, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return
+	}
+	pods, err := c.clientset.CoreV1().Pods(report.Namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector.String()})
+	if err != nil {
+		return
+	}
+	for _, pod := range pods.Items {
+		diagnostic, failing := diagnosePod(pod)
+		if !failing {
+			continue
+		}
+		report.FailingPods = append(report.FailingPods, diagnostic)
+		report.Events = append(report.Events, c.lastEvents(ctx, pod.Namespace, pod.Name)...)
+	}
+}
+
+func diagnosePod(pod v1.Pod) (PodDiagnostic, bool) {
+	diagnostic := PodDiagnostic{Name: pod.Name, Phase: pod.Status.Phase}
+	statuses := append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		switch {
+		case status.State.Waiting != nil && status.State.Waiting.Reason != "":
+			diagnostic.Reasons = append(diagnostic.Reasons, fmt.Sprintf("%s: %s: %s", status.Name, status.State.Waiting.Reason, status.State.Waiting.Message))
+		case status.State.Terminated != nil && status.State.Terminated.ExitCode != 0:
+			diagnostic.Reasons = append(diagnostic.Reasons, fmt.Sprintf("%s: %s: exit code %d", status.Name, status.State.Terminated.Reason, status.State.Terminated.ExitCode))
+		}
+	}
+
+	ready := false
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			ready = condition.Status == v1.ConditionTrue
+			if !ready && condition.Message != "" && len(diagnostic.Reasons) == 0 {
+				diagnostic.Reasons = append(diagnostic.Reasons, condition.Message)
+			}
+		}
+	}
+	if pod.Status.Phase == v1.PodSucceeded {
+		return diagnostic, false
+	}
+	return diagnostic, !ready || pod.Status.Phase == v1.PodFailed
+}
+
+func (c *KubernetesClient) lastEvents(ctx context.Context, namespace string, name string) []string {
+	events, err := c.clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("involvedObject.name", name).String(),
+	})
+	if err != nil {
+		return nil
+	}
+	items := events.Items
+	sort.Slice(items, func(i, j int) bool {
+		return eventTime(items[i]).Before(eventTime(items[j]))
+	})
+	if len(items) > diagnosticsEvents {
+		items = items[len(items)-diagnosticsEvents:]
+	}
+	var lines []string
+	for _, event := range items {
+		lines = append(lines, fmt.Sprintf("%s %s %s/%s: %s", event.Type, event.Reason, event.InvolvedObject.Kind, event.InvolvedObject.Name, event.Message))
+	}
+	return lines
+}
+
+func eventTime(event v1.Event) time.Time {
+	if !event.LastTimestamp.IsZero() {
+		return event.LastTimestamp.Time
+	}
+	if !event.EventTime.IsZero() {
+		return event.EventTime.Time
+	}
+	return event.CreationTimestamp.Time
+}
@@ -0,0 +1,94 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestCheckReadyDeployment(t *testing.T) {
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "default", "generation": int64(2)},
+		"spec": map[string]interface{}{
+			"replicas": int64(2),
+			"selector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "web"}},
+		},
+		"status": map[string]interface{}{"observedGeneration": int64(2), "updatedReplicas": int64(2), "availableReplicas": int64(1)},
+	}}
+	client := &KubernetesClient{}
+
+	ready, reason, selector, err := client.checkReady(context.Background(), deployment)
+	assert.Nil(t, err)
+	assert.False(t, ready)
+	assert.Equal(t, "1 of 2 replicas available", reason)
+	assert.Equal(t, "web", selector.MatchLabels["app"])
+
+	unstructured.SetNestedField(deployment.Object, int64(2), "status", "availableReplicas")
+	ready, _, _, err = client.checkReady(context.Background(), deployment)
+	assert.Nil(t, err)
+	assert.True(t, ready)
+
+	// like kubectl rollout status, old pods still running are not ready
+	unstructured.SetNestedField(deployment.Object, int64(3), "status", "replicas")
+	ready, reason, _, err = client.checkReady(context.Background(), deployment)
+	assert.Nil(t, err)
+	assert.False(t, ready)
+	assert.Equal(t, "1 old replicas pending termination", reason)
+}
+
+func TestCheckReadyFailedJob(t *testing.T) {
+	job := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"metadata":   map[string]interface{}{"name": "migrate", "namespace": "default"},
+		"status": map[string]interface{}{"conditions": []interface{}{
+			map[string]interface{}{"type": "Failed", "status": "True", "reason": "BackoffLimitExceeded", "message": "Job has reached the specified backoff limit"},
+		}},
+	}}
+
+	ready, _, _, err := (&KubernetesClient{}).checkReady(context.Background(), job)
+	assert.False(t, ready)
+	assert.ErrorIs(t, err, errJobFailed)
+}
+
+func TestCheckReadyIngress(t *testing.T) {
+	ingress := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "networking.k8s.io/v1",
+		"kind":       IngressKind,
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "default"},
+	}}
+	client := &KubernetesClient{}
+
+	ready, _, _, err := client.checkReady(context.Background(), ingress)
+	assert.Nil(t, err)
+	assert.False(t, ready)
+
+	unstructured.SetNestedSlice(ingress.Object, []interface{}{map[string]interface{}{"ip": "10.0.0.1"}}, "status", "loadBalancer", "ingress")
+	ready, _, _, err = client.checkReady(context.Background(), ingress)
+	assert.Nil(t, err)
+	assert.True(t, ready)
+}
+
+func TestDiagnosePod(t *testing.T) {
+	pod := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-1"},
+		Status: v1.PodStatus{
+			Phase: v1.PodPending,
+			ContainerStatuses: []v1.ContainerStatus{{
+				Name:  "nginx",
+				State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "ImagePullBackOff", Message: "Back-off pulling image"}},
+			}},
+			Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionFalse}},
+		},
+	}
+
+	diagnostic, failing := diagnosePod(pod)
+	assert.True(t, failing)
+	assert.Equal(t, []string{"nginx: ImagePullBackOff: Back-off pulling image"}, diagnostic.Reasons)
+}
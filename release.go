@@ -0,0 +1,244 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+const (
+	// ReleaseLabel is set on every object of a release, its value is the release name.
+	ReleaseLabel = "cg-controller/release"
+
+	releaseInventoryLabel  = "cg-controller/inventory"
+	releaseInventoryPrefix = "cg-release-"
+	releaseInventoryKey    = "release"
+)
+
+// ObjectRef identifies an object of a release.
+type ObjectRef struct {
+	Group     string `json:"group,omitempty"`
+	Version   string `json:"version"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+func (r ObjectRef) GroupVersionKind() schema.GroupVersionKind {
+	return schema.GroupVersionKind{Group: r.Group, Version: r.Version, Kind: r.Kind}
+}
+
+func (r ObjectRef) String() string {
+	return fmt.Sprintf("%s %s/%s", r.Kind, r.Namespace, r.Name)
+}
+
+// Release is the inventory of the objects installed under one name. It is
+// kept as JSON in the ConfigMap cg-release-<name> of the release namespace.
+type Release struct {
+	Name      string      `json:"name"`
+	Namespace string      `json:"namespace"`
+	Revision  int         `json:"revision"`
+	Updated   metav1.Time `json:"updated"`
+	Objects   []ObjectRef `json:"objects"`
+}
+
+// InstallRelease applies manifests as a new release, see UpgradeRelease to change an existing one.
+func (c *KubernetesClient) InstallRelease(ctx context.Context, namespace string, name string, manifests YAML, opts ApplyOptions) (*ApplyReport, error) {
+	if _, err := c.GetRelease(ctx, namespace, name); err == nil {
+		return nil, fmt.Errorf("release %s/%s already exists", namespace, name)
+	} else if !IsNotFound(err) {
+		return nil, err
+	}
+	opts.Release, opts.ReleaseNamespace = name, namespace
+	return c.ApplyDynamicUnstructured(ctx, manifests, opts)
+}
+
+func (c *KubernetesClient) UpgradeRelease(ctx context.Context, namespace string, name string, manifests YAML, opts ApplyOptions) (*ApplyReport, error) {
+	if _, err := c.GetRelease(ctx, namespace, name); err != nil {
+		return nil, err
+	}
+	opts.Release, opts.ReleaseNamespace = name, namespace
+	return c.ApplyDynamicUnstructured(ctx, manifests, opts)
+}
+
+func (c *KubernetesClient) GetRelease(ctx context.Context, namespace string, name string) (*Release, error) {
+	configmap, err := c.clientset.CoreV1().ConfigMaps(namespace).Get(ctx, releaseInventoryPrefix+name, metav1.GetOptions{})
+	if err != nil {
+		return nil, objectError("get", v1.SchemeGroupVersion.WithKind(ConfigMapKind), namespace, releaseInventoryPrefix+name, err)
+	}
+	return decodeRelease(configmap)
+}
+
+func (c *KubernetesClient) ListReleases(ctx context.Context, namespace string) ([]Release, error) {
+	configmaps, err := c.clientset.CoreV1().ConfigMaps(namespace).List(ctx, metav1.ListOptions{LabelSelector: releaseInventoryLabel + "=true"})
+	if err != nil {
+		return nil, err
+	}
+	var releases []Release
+	for i := range configmaps.Items {
+		release, err := decodeRelease(&configmaps.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		releases = append(releases, *release)
+	}
+	sort.Slice(releases, func(i, j int) bool { return releases[i].Name < releases[j].Name })
+	return releases, nil
+}
+
+// UninstallRelease deletes the objects of a release in reverse install order,
+// then its inventory. Objects that are already gone are skipped.
+func (c *KubernetesClient) UninstallRelease(ctx context.Context, namespace string, name string) error {
+	release, err := c.GetRelease(ctx, namespace, name)
+	if err != nil {
+		return err
+	}
+
+	objects := append([]ObjectRef{}, release.Objects...)
+	sort.SliceStable(objects, func(i, j int) bool {
+		return installOrderIndex(objects[i].Kind) > installOrderIndex(objects[j].Kind)
+	})
+	var errs []error
+	for _, ref := range objects {
+		if err := c.deleteRef(ctx, ref, false); err != nil && !IsNotFound(err) {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+
+	err = c.clientset.CoreV1().ConfigMaps(namespace).Delete(ctx, releaseInventoryPrefix+name, metav1.DeleteOptions{})
+	if err != nil {
+		return objectError("delete", v1.SchemeGroupVersion.WithKind(ConfigMapKind), namespace, releaseInventoryPrefix+name, err)
+	}
+	fmt.Printf("Uninstalled release %s \n", name)
+	return nil
+}
+
+// recordRelease stores the objects of report that were applied in the release
+// inventory. Objects of the previous revision that were not pruned stay
+// recorded, they still exist and UninstallRelease has to remove them.
+func (c *KubernetesClient) recordRelease(ctx context.Context, namespace string, name string, report *ApplyReport) error {
+	previous, err := c.GetRelease(ctx, namespace, name)
+	if err != nil && !IsNotFound(err) {
+		return err
+	}
+
+	var objects []ObjectRef
+	recorded := map[ObjectRef]struct{}{}
+	for _, result := range report.Results {
+		if result.Err != nil {
+			continue
+		}
+		ref := ObjectRef{Group: result.GVK.Group, Version: result.GVK.Version, Kind: result.GVK.Kind, Namespace: result.Namespace, Name: result.Name}
+		objects = append(objects, ref)
+		recorded[unversioned(ref)] = struct{}{}
+	}
+	for _, result := range report.Pruned {
+		if result.Err == nil {
+			recorded[ObjectRef{Group: result.GVK.Group, Kind: result.GVK.Kind, Namespace: result.Namespace, Name: result.Name}] = struct{}{}
+		}
+	}
+	if previous != nil {
+		for _, ref := range previous.Objects {
+			if _, ok := recorded[unversioned(ref)]; !ok {
+				objects = append(objects, ref)
+			}
+		}
+	}
+	return c.saveRelease(ctx, namespace, name, objects)
+}
+
+func (c *KubernetesClient) saveRelease(ctx context.Context, namespace string, name string, objects []ObjectRef) error {
+	configmaps := c.clientset.CoreV1().ConfigMaps(namespace)
+	gvk := v1.SchemeGroupVersion.WithKind(ConfigMapKind)
+
+	existing, err := configmaps.Get(ctx, releaseInventoryPrefix+name, metav1.GetOptions{})
+	if err != nil && !IsNotFound(err) {
+		return objectError("get", gvk, namespace, releaseInventoryPrefix+name, err)
+	}
+	found := err == nil
+
+	release := &Release{Name: name, Namespace: namespace, Revision: 1, Updated: metav1.NewTime(time.Now()), Objects: objects}
+	if found {
+		previous, err := decodeRelease(existing)
+		if err != nil {
+			return err
+		}
+		release.Revision = previous.Revision + 1
+	}
+	data, err := json.Marshal(release)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		_, err = configmaps.Create(ctx, &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   releaseInventoryPrefix + name,
+				Labels: map[string]string{ReleaseLabel: name, releaseInventoryLabel: "true"},
+			},
+			Data: map[string]string{releaseInventoryKey: string(data)},
+		}, metav1.CreateOptions{})
+		return objectError("create", gvk, namespace, releaseInventoryPrefix+name, err)
+	}
+	existing.Data = map[string]string{releaseInventoryKey: string(data)}
+	_, err = configmaps.Update(ctx, existing, metav1.UpdateOptions{})
+	return objectError("update", gvk, namespace, releaseInventoryPrefix+name, err)
+}
+
+// recordApplicationRelease labels the objects of an application service and
+// records them as release name, so UninstallRelease can remove them later.
+func (c *KubernetesClient) recordApplicationRelease(ctx context.Context, namespace string, name string, objects []ObjectRef) error {
+	for _, ref := range objects {
+		if err := c.labelRef(ctx, ref, map[string]string{ReleaseLabel: name}); err != nil {
+			return err
+		}
+	}
+	return c.saveRelease(ctx, namespace, name, objects)
+}
+
+func decodeRelease(configmap *v1.ConfigMap) (*Release, error) {
+	release := &Release{}
+	if err := json.Unmarshal([]byte(configmap.Data[releaseInventoryKey]), release); err != nil {
+		return nil, decodeError(fmt.Errorf("release inventory %s/%s: %v", configmap.Namespace, configmap.Name, err))
+	}
+	return release, nil
+}
+
+// labelRef merges labels into the labels of the referenced object.
+func (c *KubernetesClient) labelRef(ctx context.Context, ref ObjectRef, labels map[string]string) error {
+	mapping, err := c.restMapping(ref.GroupVersionKind())
+	if err != nil {
+		return objectError("label", ref.GroupVersionKind(), ref.Namespace, ref.Name, err)
+	}
+	patch, err := json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{"labels": labels}})
+	if err != nil {
+		return err
+	}
+	_, err = c.resourceInterface(mapping, ref.Namespace).Patch(ctx, ref.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return objectError("label", ref.GroupVersionKind(), ref.Namespace, ref.Name, err)
+}
+
+func (c *KubernetesClient) deleteRef(ctx context.Context, ref ObjectRef, dryRun bool) error {
+	mapping, err := c.restMapping(ref.GroupVersionKind())
+	if err != nil {
+		return objectError("delete", ref.GroupVersionKind(), ref.Namespace, ref.Name, err)
+	}
+	deletePolicy := metav1.DeletePropagationBackground
+	deleteOptions := metav1.DeleteOptions{PropagationPolicy: &deletePolicy}
+	if dryRun {
+		deleteOptions.DryRun = []string{metav1.DryRunAll}
+	}
+	err = c.resourceInterface(mapping, ref.Namespace).Delete(ctx, ref.Name, deleteOptions)
+	return objectError("delete", ref.GroupVersionKind(), ref.Namespace, ref.Name, err)
+}
@@ -0,0 +1,27 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDecodeRelease(t *testing.T) {
+	release := Release{Name: "redis", Namespace: "default", Revision: 2, Objects: []ObjectRef{
+		{Version: "v1", Kind: ServiceKind, Namespace: "default", Name: "redis"},
+		{Group: "apps", Version: "v1", Kind: StatefulSetKind, Namespace: "default", Name: "redis-master"},
+	}}
+	data, err := json.Marshal(release)
+	assert.Nil(t, err)
+
+	decoded, err := decodeRelease(&v1.ConfigMap{Data: map[string]string{releaseInventoryKey: string(data)}})
+	assert.Nil(t, err)
+	assert.Equal(t, release.Objects, decoded.Objects)
+	assert.Equal(t, "apps/v1, Kind=StatefulSet", decoded.Objects[1].GroupVersionKind().String())
+
+	_, err = decodeRelease(&v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: releaseInventoryPrefix + "broken"}})
+	assert.True(t, IsDecodeError(err))
+}
@@ -0,0 +1,332 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	appsv1ac "k8s.io/client-go/applyconfigurations/apps/v1"
+)
+
+const (
+	// ConfigChecksumAnnotation on a pod template holds the checksum of the
+	// ConfigMaps and Secrets the pods use, a new value rolls the pods.
+	ConfigChecksumAnnotation = "cg-controller/config-checksum"
+
+	// ConfigRefsAnnotation on a pod template lists config the pods depend on
+	// without referencing it in their spec, e.g. "ConfigMap/settings,Secret/db".
+	ConfigRefsAnnotation = "cg-controller/config-refs"
+)
+
+// rolloutKinds are the workloads whose pod template gets a config checksum.
+var rolloutKinds = []string{DeploymentKind, StatefulSetKind, DaemonSetKind}
+
+// ConfigRefs returns the ConfigMaps and Secrets template uses through env,
+// envFrom, volumes and ConfigRefsAnnotation, sorted and without duplicates.
+// The refs have no namespace, pods only reach config in their own.
+func ConfigRefs(template *v1.PodTemplateSpec) []ObjectRef {
+	refs := map[ObjectRef]struct{}{}
+	add := func(kind string, name string) {
+		if name != "" {
+			refs[ObjectRef{Version: "v1", Kind: kind, Name: name}] = struct{}{}
+		}
+	}
+
+	for _, ref := range strings.Split(template.Annotations[ConfigRefsAnnotation], ",") {
+		if kind, name, ok := strings.Cut(strings.TrimSpace(ref), "/"); ok && (kind == ConfigMapKind || kind == SecretKind) {
+			add(kind, name)
+		}
+	}
+	spec := &template.Spec
+	for _, container := range append(append([]v1.Container{}, spec.InitContainers...), spec.Containers...) {
+		for _, env := range container.Env {
+			if env.ValueFrom == nil {
+				continue
+			}
+			if ref := env.ValueFrom.ConfigMapKeyRef; ref != nil {
+				add(ConfigMapKind, ref.Name)
+			}
+			if ref := env.ValueFrom.SecretKeyRef; ref != nil {
+				add(SecretKind, ref.Name)
+			}
+		}
+		for _, envFrom := range container.EnvFrom {
+			if envFrom.ConfigMapRef != nil {
+				add(ConfigMapKind, envFrom.ConfigMapRef.Name)
+			}
+			if envFrom.SecretRef != nil {
+				add(SecretKind, envFrom.SecretRef.Name)
+			}
+		}
+	}
+	for _, volume := range spec.Volumes {
+		if volume.ConfigMap != nil {
+			add(ConfigMapKind, volume.ConfigMap.Name)
+		}
+		if volume.Secret != nil {
+			add(SecretKind, volume.Secret.SecretName)
+		}
+		if volume.Projected == nil {
+			continue
+		}
+		for _, source := range volume.Projected.Sources {
+			if source.ConfigMap != nil {
+				add(ConfigMapKind, source.ConfigMap.Name)
+			}
+			if source.Secret != nil {
+				add(SecretKind, source.Secret.Name)
+			}
+		}
+	}
+
+	sorted := make([]ObjectRef, 0, len(refs))
+	for ref := range refs {
+		sorted = append(sorted, ref)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].String() < sorted[j].String() })
+	return sorted
+}
+
+// ConfigChecksum hashes the content of the config template uses in
+// namespace, "" when it uses none. Missing config counts as absent, so
+// creating it later changes the checksum.
+func (c *KubernetesClient) ConfigChecksum(ctx context.Context, namespace string, template *v1.PodTemplateSpec) (string, error) {
+	return c.configChecksum(ctx, namespace, template, nil)
+}
+
+// configChecksum prefers the objects of pending, e.g. those just applied in
+// a dry run, over the live ones.
+func (c *KubernetesClient) configChecksum(ctx context.Context, namespace string, template *v1.PodTemplateSpec, pending map[ObjectRef]*unstructured.Unstructured) (string, error) {
+	refs := ConfigRefs(template)
+	if len(refs) == 0 {
+		return "", nil
+	}
+	var entries [][]interface{}
+	for _, ref := range refs {
+		ref.Namespace = namespace
+		obj, ok := pending[ref]
+		if !ok {
+			var err error
+			obj, err = c.GetByGVK(ctx, ref.GroupVersionKind(), namespace, ref.Name)
+			if IsNotFound(err) {
+				entries = append(entries, []interface{}{ref.String(), "absent"})
+				continue
+			}
+			if err != nil {
+				return "", err
+			}
+		}
+		entries = append(entries, []interface{}{ref.String(), obj.Object["data"], obj.Object["binaryData"]})
+	}
+	return contentHash(entries)
+}
+
+func isRolloutKind(obj *unstructured.Unstructured) bool {
+	gvk := obj.GroupVersionKind()
+	if gvk.Group != appsv1.GroupName {
+		return false
+	}
+	for _, kind := range rolloutKinds {
+		if gvk.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func podTemplateOf(obj *unstructured.Unstructured) (*v1.PodTemplateSpec, error) {
+	content, _, err := unstructured.NestedMap(obj.Object, "spec", "template")
+	if err != nil {
+		return nil, err
+	}
+	template := &v1.PodTemplateSpec{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(content, template); err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+// stampConfigChecksum sets ConfigChecksumAnnotation on the pod template of a
+// workload, other objects and workloads without config are left as they are.
+func (c *KubernetesClient) stampConfigChecksum(ctx context.Context, obj *unstructured.Unstructured, pending map[ObjectRef]*unstructured.Unstructured) error {
+	if !isRolloutKind(obj) {
+		return nil
+	}
+	namespace := obj.GetNamespace()
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	template, err := podTemplateOf(obj)
+	if err != nil {
+		return objectError("checksum", obj.GroupVersionKind(), namespace, obj.GetName(), err)
+	}
+	sum, err := c.configChecksum(ctx, namespace, template, pending)
+	if err != nil {
+		return objectError("checksum", obj.GroupVersionKind(), namespace, obj.GetName(), err)
+	}
+	if sum == "" {
+		return nil
+	}
+	return unstructured.SetNestedField(obj.Object, sum, "spec", "template", "metadata", "annotations", ConfigChecksumAnnotation)
+}
+
+// RolloutConfigDependents updates the config checksum of the workloads in
+// namespace that use the ConfigMap or Secret name, which rolls their pods.
+// Workloads whose checksum is current are left alone. It returns the
+// workloads it rolled.
+func (c *KubernetesClient) RolloutConfigDependents(ctx context.Context, namespace string, kind string, name string) ([]ObjectRef, error) {
+	config := ObjectRef{Version: "v1", Kind: kind, Name: name}
+	var rolled []ObjectRef
+	for _, workloadKind := range rolloutKinds {
+		gvk := appsv1.SchemeGroupVersion.WithKind(workloadKind)
+		workloads, err := c.ListByGVK(ctx, gvk, namespace)
+		if err != nil {
+			return rolled, err
+		}
+		for i := range workloads.Items {
+			workload := &workloads.Items[i]
+			template, err := podTemplateOf(workload)
+			if err != nil {
+				return rolled, objectError("checksum", gvk, namespace, workload.GetName(), err)
+			}
+			uses := false
+			for _, ref := range ConfigRefs(template) {
+				uses = uses || ref == config
+			}
+			if !uses {
+				continue
+			}
+
+			sum, err := c.ConfigChecksum(ctx, namespace, template)
+			if err != nil {
+				return rolled, objectError("checksum", gvk, namespace, workload.GetName(), err)
+			}
+			if template.Annotations[ConfigChecksumAnnotation] == sum {
+				continue
+			}
+			if err := c.applyConfigChecksum(ctx, workload, sum); err != nil {
+				return rolled, objectError("rollout", gvk, namespace, workload.GetName(), err)
+			}
+			ref := ObjectRef{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind, Namespace: namespace, Name: workload.GetName()}
+			fmt.Printf("Rolling %s, %s %s changed\n", ref, kind, name)
+			rolled = append(rolled, ref)
+		}
+	}
+	return rolled, nil
+}
+
+// applyConfigChecksum sets the checksum of workload by server-side apply as
+// defaultFieldManager, so a later ApplyDynamicUnstructured still owns the
+// annotation and can change it without a conflict. The apply carries the
+// fields the manager already owns, without them it would remove them, and
+// forces only to take the annotation over from e.g. CreateDeployFromSpec.
+func (c *KubernetesClient) applyConfigChecksum(ctx context.Context, workload *unstructured.Unstructured, sum string) error {
+	var config interface{}
+	var err error
+	switch workload.GetKind() {
+	case DeploymentKind:
+		deployment := &appsv1.Deployment{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(workload.Object, deployment); err != nil {
+			return err
+		}
+		config, err = appsv1ac.ExtractDeployment(deployment, defaultFieldManager)
+	case StatefulSetKind:
+		statefulset := &appsv1.StatefulSet{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(workload.Object, statefulset); err != nil {
+			return err
+		}
+		config, err = appsv1ac.ExtractStatefulSet(statefulset, defaultFieldManager)
+	case DaemonSetKind:
+		daemonset := &appsv1.DaemonSet{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(workload.Object, daemonset); err != nil {
+			return err
+		}
+		config, err = appsv1ac.ExtractDaemonSet(daemonset, defaultFieldManager)
+	default:
+		return fmt.Errorf("%s has no pod template", workload.GetKind())
+	}
+	if err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	applied := &unstructured.Unstructured{}
+	if err := json.Unmarshal(content, &applied.Object); err != nil {
+		return err
+	}
+	if err := unstructured.SetNestedField(applied.Object, sum, "spec", "template", "metadata", "annotations", ConfigChecksumAnnotation); err != nil {
+		return err
+	}
+	patch, err := json.Marshal(applied)
+	if err != nil {
+		return err
+	}
+	mapping, err := c.restMapping(workload.GroupVersionKind())
+	if err != nil {
+		return err
+	}
+	force := true
+	_, err = c.resourceInterface(mapping, workload.GetNamespace()).Patch(ctx, workload.GetName(), types.ApplyPatchType, patch, metav1.PatchOptions{FieldManager: defaultFieldManager, Force: &force})
+	return err
+}
+
+// ConfigRolloutWatcher rolls workloads when the content of a ConfigMap or
+// Secret they use changes, see RolloutConfigDependents.
+type ConfigRolloutWatcher struct {
+	client  *KubernetesClient
+	watcher *EventWatcher
+}
+
+// NewConfigRolloutWatcher watches namespace, "" for all namespaces. A resync of 0 disables resyncs.
+func (c *KubernetesClient) NewConfigRolloutWatcher(namespace string, resync time.Duration) *ConfigRolloutWatcher {
+	return &ConfigRolloutWatcher{client: c, watcher: c.NewEventWatcher(namespace, resync)}
+}
+
+// Start watches ConfigMaps and Secrets until ctx is cancelled. Config that
+// exists when the watcher starts does not roll anything.
+func (w *ConfigRolloutWatcher) Start(ctx context.Context) error {
+	rollout := func(kind string, obj metav1.Object) {
+		if _, err := w.client.RolloutConfigDependents(ctx, obj.GetNamespace(), kind, obj.GetName()); err != nil && ctx.Err() == nil {
+			fmt.Printf("Rollout for %s %s/%s failed: %v\n", kind, obj.GetNamespace(), obj.GetName(), err)
+		}
+	}
+
+	err := w.watcher.AddHandler(v1.SchemeGroupVersion.WithKind(ConfigMapKind), EventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj runtime.Object) {
+			old, okOld := oldObj.(*v1.ConfigMap)
+			updated, okNew := newObj.(*v1.ConfigMap)
+			if okOld && okNew && !(reflect.DeepEqual(old.Data, updated.Data) && reflect.DeepEqual(old.BinaryData, updated.BinaryData)) {
+				rollout(ConfigMapKind, updated)
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+	err = w.watcher.AddHandler(v1.SchemeGroupVersion.WithKind(SecretKind), EventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj runtime.Object) {
+			old, okOld := oldObj.(*v1.Secret)
+			updated, okNew := newObj.(*v1.Secret)
+			if okOld && okNew && !reflect.DeepEqual(old.Data, updated.Data) {
+				rollout(SecretKind, updated)
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return w.watcher.Start(ctx)
+}
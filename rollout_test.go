@@ -0,0 +1,211 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func configTestDeployment(name string, template v1.PodTemplateSpec) *appsv1.Deployment {
+	template.Labels = map[string]string{"app": name}
+	return &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: DeploymentKind},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": name}},
+			Template: template,
+		},
+	}
+}
+
+func envFromConfigMap(name string) v1.PodTemplateSpec {
+	return v1.PodTemplateSpec{Spec: v1.PodSpec{Containers: []v1.Container{{
+		Name:    "app",
+		Image:   "nginx",
+		EnvFrom: []v1.EnvFromSource{{ConfigMapRef: &v1.ConfigMapEnvSource{LocalObjectReference: v1.LocalObjectReference{Name: name}}}},
+	}}}}
+}
+
+func checksumOf(t *testing.T, cluster *fakeCluster, name string) string {
+	deployment, err := cluster.client.GetByGVK(context.Background(), appsv1.SchemeGroupVersion.WithKind(DeploymentKind), "default", name)
+	assert.Nil(t, err)
+	sum, _, _ := unstructured.NestedString(deployment.Object, "spec", "template", "metadata", "annotations", ConfigChecksumAnnotation)
+	return sum
+}
+
+func TestConfigRefs(t *testing.T) {
+	template := &v1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{ConfigRefsAnnotation: "ConfigMap/declared, Secret/declared-secret, Pod/ignored"}},
+		Spec: v1.PodSpec{
+			InitContainers: []v1.Container{{Env: []v1.EnvVar{{Name: "TOKEN", ValueFrom: &v1.EnvVarSource{
+				SecretKeyRef: &v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: "token"}, Key: "token"},
+			}}}}},
+			Containers: []v1.Container{{
+				Env: []v1.EnvVar{{Name: "MODE", ValueFrom: &v1.EnvVarSource{
+					ConfigMapKeyRef: &v1.ConfigMapKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: "settings"}, Key: "mode"},
+				}}},
+				EnvFrom: []v1.EnvFromSource{
+					{ConfigMapRef: &v1.ConfigMapEnvSource{LocalObjectReference: v1.LocalObjectReference{Name: "settings"}}},
+					{SecretRef: &v1.SecretEnvSource{LocalObjectReference: v1.LocalObjectReference{Name: "db"}}},
+				},
+			}},
+			Volumes: []v1.Volume{
+				{Name: "conf", VolumeSource: v1.VolumeSource{ConfigMap: &v1.ConfigMapVolumeSource{LocalObjectReference: v1.LocalObjectReference{Name: "nginx"}}}},
+				{Name: "tls", VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: "tls"}}},
+				{Name: "all", VolumeSource: v1.VolumeSource{Projected: &v1.ProjectedVolumeSource{Sources: []v1.VolumeProjection{
+					{ConfigMap: &v1.ConfigMapProjection{LocalObjectReference: v1.LocalObjectReference{Name: "projected"}}},
+					{Secret: &v1.SecretProjection{LocalObjectReference: v1.LocalObjectReference{Name: "projected-secret"}}},
+				}}}},
+			},
+		},
+	}
+
+	var names []string
+	for _, ref := range ConfigRefs(template) {
+		names = append(names, ref.Kind+"/"+ref.Name)
+	}
+	assert.Equal(t, []string{
+		"ConfigMap/declared", "ConfigMap/nginx", "ConfigMap/projected", "ConfigMap/settings",
+		"Secret/db", "Secret/declared-secret", "Secret/projected-secret", "Secret/tls", "Secret/token",
+	}, names)
+}
+
+func TestConfigChecksum(t *testing.T) {
+	cluster := newFakeCluster(&v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: "default"}, Data: map[string]string{"mode": "a"}})
+	client := cluster.client
+	ctx := context.Background()
+	template := envFromConfigMap("settings")
+
+	sum, err := client.ConfigChecksum(ctx, "default", &template)
+	assert.Nil(t, err)
+	assert.Len(t, sum, 64)
+	again, err := client.ConfigChecksum(ctx, "default", &template)
+	assert.Nil(t, err)
+	assert.Equal(t, sum, again)
+
+	_, err = client.UpdateConfigMapFromSpec(ctx, "default", NewConfigDataSpec("settings").WithLiteral("mode", "b"))
+	assert.Nil(t, err)
+	changed, err := client.ConfigChecksum(ctx, "default", &template)
+	assert.Nil(t, err)
+	assert.NotEqual(t, sum, changed)
+
+	// missing config is hashed as absent, in another namespace it is missing
+	other, err := client.ConfigChecksum(ctx, "other", &template)
+	assert.Nil(t, err)
+	assert.NotEqual(t, changed, other)
+
+	none, err := client.ConfigChecksum(ctx, "default", &v1.PodTemplateSpec{})
+	assert.Nil(t, err)
+	assert.Equal(t, "", none)
+}
+
+const configChecksumManifests = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  selector:
+    matchLabels:
+      app: web
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      containers:
+      - name: web
+        image: nginx
+        volumeMounts:
+        - name: conf
+          mountPath: /etc/nginx/conf.d
+      volumes:
+      - name: conf
+        configMap:
+          name: nginx
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: nginx
+data:
+  default.conf: `
+
+func TestApplyConfigChecksum(t *testing.T) {
+	cluster := newFakeCluster()
+	ctx := context.Background()
+
+	report, err := cluster.client.ApplyDynamicUnstructured(ctx, configChecksumManifests+"listen 80;", ApplyOptions{ConfigChecksum: true})
+	assert.Nil(t, err)
+	assert.Nil(t, report.Err())
+	first := checksumOf(t, cluster, "web")
+	assert.NotEmpty(t, first)
+
+	// a dry run sees the config of the same manifests, not the live one
+	report, err = cluster.client.ApplyDynamicUnstructured(ctx, configChecksumManifests+"listen 8080;", ApplyOptions{ConfigChecksum: true, DryRun: true})
+	assert.Nil(t, err)
+	assert.Nil(t, report.Err())
+	var changes []string
+	for _, result := range report.Results {
+		for _, change := range result.Diff {
+			changes = append(changes, change.Path)
+		}
+	}
+	assert.Contains(t, changes, `spec.template.metadata.annotations["`+ConfigChecksumAnnotation+`"]`)
+	assert.Equal(t, first, checksumOf(t, cluster, "web"))
+
+	report, err = cluster.client.ApplyDynamicUnstructured(ctx, configChecksumManifests+"listen 8080;", ApplyOptions{ConfigChecksum: true})
+	assert.Nil(t, err)
+	assert.Nil(t, report.Err())
+	assert.NotEqual(t, first, checksumOf(t, cluster, "web"))
+}
+
+func TestRolloutConfigDependents(t *testing.T) {
+	cluster := newFakeCluster(
+		&v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: "default"}, Data: map[string]string{"mode": "a"}},
+		configTestDeployment("web", envFromConfigMap("settings")),
+		configTestDeployment("other", envFromConfigMap("unrelated")),
+	)
+	client := cluster.client
+	ctx := context.Background()
+
+	rolled, err := client.RolloutConfigDependents(ctx, "default", ConfigMapKind, "settings")
+	assert.Nil(t, err)
+	assert.Equal(t, []ObjectRef{{Group: "apps", Version: "v1", Kind: DeploymentKind, Namespace: "default", Name: "web"}}, rolled)
+	assert.NotEmpty(t, checksumOf(t, cluster, "web"))
+	assert.Empty(t, checksumOf(t, cluster, "other"))
+
+	// nothing changed, nothing rolls
+	rolled, err = client.RolloutConfigDependents(ctx, "default", ConfigMapKind, "settings")
+	assert.Nil(t, err)
+	assert.Empty(t, rolled)
+}
+
+func TestConfigRolloutWatcher(t *testing.T) {
+	cluster := newFakeCluster(&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}})
+	client := cluster.client
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// CreateApplicationService declares its ConfigMap on the pod template
+	assert.Nil(t, client.CreateApplicationService(ctx, "default", "web", 1, "web", "nginx:1.25",
+		v1.ServiceTypeClusterIP, "mode", "a", "db", "10.0.0.1", "postgres", 5432, v1.ProtocolTCP))
+	first := checksumOf(t, cluster, "web")
+	assert.NotEmpty(t, first)
+
+	watcher := client.NewConfigRolloutWatcher("default", 0)
+	assert.Nil(t, watcher.Start(ctx))
+
+	_, err := client.UpdateConfigMapFromSpec(ctx, "default", NewConfigDataSpec("web").WithLiteral("mode", "b"))
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool {
+		sum := checksumOf(t, cluster, "web")
+		return sum != "" && sum != first
+	}, 5*time.Second, 10*time.Millisecond)
+}
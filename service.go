@@ -0,0 +1,212 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// ServicePortSpec is one port of a service. TargetPort may name a container
+// port, e.g. intstr.FromString("http"), and defaults to Port.
+type ServicePortSpec struct {
+	Name       string      // required when the service has more than one port
+	Protocol   v1.Protocol // TCP, UDP or SCTP, defaults to TCP
+	Port       int32
+	TargetPort intstr.IntOrString
+	NodePort   int32 // NodePort and LoadBalancer only, 0 lets the cluster pick one
+}
+
+// ServiceSpec describes a Service for CreateServiceFromSpec.
+type ServiceSpec struct {
+	Name        string
+	Type        v1.ServiceType // defaults to ClusterIP
+	Labels      map[string]string
+	Annotations map[string]string
+	Selector    map[string]string
+	Ports       []ServicePortSpec
+
+	Headless     bool   // ClusterIP None, DNS returns the pod IPs
+	ExternalName string // CNAME target of an ExternalName service
+
+	SessionAffinity        v1.ServiceAffinity
+	SessionAffinityTimeout int32 // seconds, ClientIP affinity only
+	ExternalTrafficPolicy  v1.ServiceExternalTrafficPolicy
+	IPFamilyPolicy         v1.IPFamilyPolicy
+	IPFamilies             []v1.IPFamily
+}
+
+func NewServiceSpec(name string, servicetype v1.ServiceType) *ServiceSpec {
+	return &ServiceSpec{Name: name, Type: servicetype}
+}
+
+func (s *ServiceSpec) WithLabel(key string, value string) *ServiceSpec {
+	s.Labels = setKey(s.Labels, key, value)
+	return s
+}
+
+// WithAnnotation sets e.g. load balancer options like "service.beta.kubernetes.io/aws-load-balancer-type".
+func (s *ServiceSpec) WithAnnotation(key string, value string) *ServiceSpec {
+	s.Annotations = setKey(s.Annotations, key, value)
+	return s
+}
+
+func (s *ServiceSpec) WithSelector(key string, value string) *ServiceSpec {
+	s.Selector = setKey(s.Selector, key, value)
+	return s
+}
+
+func (s *ServiceSpec) WithPort(port ServicePortSpec) *ServiceSpec {
+	s.Ports = append(s.Ports, port)
+	return s
+}
+
+func (s *ServiceSpec) WithHeadless() *ServiceSpec {
+	s.Headless = true
+	return s
+}
+
+// WithExternalName makes the service an alias for host, it has no selector or ports.
+func (s *ServiceSpec) WithExternalName(host string) *ServiceSpec {
+	s.Type = v1.ServiceTypeExternalName
+	s.ExternalName = host
+	return s
+}
+
+// WithSessionAffinity sends a client to the same pod, a timeoutSeconds of 0 uses the cluster default.
+func (s *ServiceSpec) WithSessionAffinity(affinity v1.ServiceAffinity, timeoutSeconds int32) *ServiceSpec {
+	s.SessionAffinity = affinity
+	s.SessionAffinityTimeout = timeoutSeconds
+	return s
+}
+
+func (s *ServiceSpec) WithExternalTrafficPolicy(policy v1.ServiceExternalTrafficPolicy) *ServiceSpec {
+	s.ExternalTrafficPolicy = policy
+	return s
+}
+
+// WithIPFamilies sets the IP families in order of preference, e.g. IPv6 first on dual-stack clusters.
+func (s *ServiceSpec) WithIPFamilies(policy v1.IPFamilyPolicy, families ...v1.IPFamily) *ServiceSpec {
+	s.IPFamilyPolicy = policy
+	s.IPFamilies = families
+	return s
+}
+
+// Service returns the Service described by the spec, or the first
+// combination of settings the API server would reject.
+func (s *ServiceSpec) Service(namespace string) (*v1.Service, error) {
+	if s.Name == "" {
+		return nil, errors.New("service name is required")
+	}
+	servicetype := s.Type
+	if servicetype == "" {
+		servicetype = v1.ServiceTypeClusterIP
+	}
+	exposesNodes := servicetype == v1.ServiceTypeNodePort || servicetype == v1.ServiceTypeLoadBalancer
+
+	service := &v1.Service{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: ServiceKind},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        s.Name,
+			Namespace:   namespace,
+			Labels:      s.Labels,
+			Annotations: s.Annotations,
+		},
+		Spec: v1.ServiceSpec{
+			Type:                  servicetype,
+			Selector:              s.Selector,
+			SessionAffinity:       s.SessionAffinity,
+			ExternalTrafficPolicy: s.ExternalTrafficPolicy,
+			IPFamilies:            s.IPFamilies,
+		},
+	}
+	if s.IPFamilyPolicy != "" {
+		policy := s.IPFamilyPolicy
+		service.Spec.IPFamilyPolicy = &policy
+	}
+	if s.SessionAffinityTimeout > 0 {
+		if s.SessionAffinity != v1.ServiceAffinityClientIP {
+			return nil, fmt.Errorf("service %s: session affinity timeout needs ClientIP affinity", s.Name)
+		}
+		timeout := s.SessionAffinityTimeout
+		service.Spec.SessionAffinityConfig = &v1.SessionAffinityConfig{ClientIP: &v1.ClientIPConfig{TimeoutSeconds: &timeout}}
+	}
+	if s.ExternalTrafficPolicy != "" && !exposesNodes {
+		return nil, fmt.Errorf("service %s: external traffic policy needs type NodePort or LoadBalancer, not %s", s.Name, servicetype)
+	}
+
+	switch {
+	case servicetype == v1.ServiceTypeExternalName:
+		if s.ExternalName == "" {
+			return nil, fmt.Errorf("service %s: type ExternalName needs an external name", s.Name)
+		}
+		if s.Headless || len(s.Selector) > 0 {
+			return nil, fmt.Errorf("service %s: an ExternalName service has no selector and is not headless", s.Name)
+		}
+		service.Spec.ExternalName = s.ExternalName
+	case s.ExternalName != "":
+		return nil, fmt.Errorf("service %s: external name needs type ExternalName, not %s", s.Name, servicetype)
+	case s.Headless:
+		if servicetype != v1.ServiceTypeClusterIP {
+			return nil, fmt.Errorf("service %s: a headless service must be of type ClusterIP, not %s", s.Name, servicetype)
+		}
+		service.Spec.ClusterIP = v1.ClusterIPNone
+	case len(s.Ports) == 0:
+		return nil, fmt.Errorf("service %s needs at least one port", s.Name)
+	}
+
+	names := map[string]bool{}
+	for _, port := range s.Ports {
+		if port.Port <= 0 || port.Port > 65535 {
+			return nil, fmt.Errorf("service %s: port %d is out of range", s.Name, port.Port)
+		}
+		if len(s.Ports) > 1 && port.Name == "" {
+			return nil, fmt.Errorf("service %s: port %d needs a name, the service has several ports", s.Name, port.Port)
+		}
+		if names[port.Name] {
+			return nil, fmt.Errorf("service %s: port name %q is used twice", s.Name, port.Name)
+		}
+		names[port.Name] = true
+		if port.NodePort != 0 && !exposesNodes {
+			return nil, fmt.Errorf("service %s: node port %d needs type NodePort or LoadBalancer, not %s", s.Name, port.NodePort, servicetype)
+		}
+
+		protocol := port.Protocol
+		switch protocol {
+		case "":
+			protocol = v1.ProtocolTCP
+		case v1.ProtocolTCP, v1.ProtocolUDP, v1.ProtocolSCTP:
+		default:
+			return nil, fmt.Errorf("service %s: unsupported protocol %q", s.Name, protocol)
+		}
+		targetPort := port.TargetPort
+		if targetPort.Type == intstr.Int && targetPort.IntVal == 0 {
+			targetPort = intstr.FromInt32(port.Port)
+		}
+		service.Spec.Ports = append(service.Spec.Ports, v1.ServicePort{
+			Name:       port.Name,
+			Protocol:   protocol,
+			Port:       port.Port,
+			TargetPort: targetPort,
+			NodePort:   port.NodePort,
+		})
+	}
+	return service, nil
+}
+
+func (c *KubernetesClient) CreateServiceFromSpec(ctx context.Context, namespace string, spec *ServiceSpec) (*v1.Service, error) {
+	gvk := v1.SchemeGroupVersion.WithKind(ServiceKind)
+	service, err := spec.Service(namespace)
+	if err != nil {
+		return nil, objectError("create", gvk, namespace, spec.Name, err)
+	}
+	result, err := c.clientset.CoreV1().Services(namespace).Create(ctx, service, metav1.CreateOptions{})
+	if err != nil {
+		return nil, objectError("create", gvk, namespace, spec.Name, err)
+	}
+	fmt.Printf("Created service %s\n", result.ObjectMeta.Name)
+	return result, nil
+}
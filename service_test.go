@@ -0,0 +1,83 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestServiceSpec(t *testing.T) {
+	service, err := NewServiceSpec("dns", v1.ServiceTypeLoadBalancer).
+		WithSelector("app", "coredns").
+		WithAnnotation("service.beta.kubernetes.io/aws-load-balancer-type", "nlb").
+		WithPort(ServicePortSpec{Name: "dns", Protocol: v1.ProtocolUDP, Port: 53}).
+		WithPort(ServicePortSpec{Name: "dns-tcp", Port: 53, TargetPort: intstr.FromString("dns-tcp"), NodePort: 30053}).
+		WithSessionAffinity(v1.ServiceAffinityClientIP, 600).
+		WithExternalTrafficPolicy(v1.ServiceExternalTrafficPolicyLocal).
+		WithIPFamilies(v1.IPFamilyPolicyPreferDualStack, v1.IPv6Protocol, v1.IPv4Protocol).
+		Service("kube-system")
+	assert.Nil(t, err)
+	assert.Equal(t, "kube-system", service.Namespace)
+	assert.Equal(t, "nlb", service.Annotations["service.beta.kubernetes.io/aws-load-balancer-type"])
+	assert.Equal(t, []v1.ServicePort{
+		{Name: "dns", Protocol: v1.ProtocolUDP, Port: 53, TargetPort: intstr.FromInt32(53)},
+		{Name: "dns-tcp", Protocol: v1.ProtocolTCP, Port: 53, TargetPort: intstr.FromString("dns-tcp"), NodePort: 30053},
+	}, service.Spec.Ports)
+	assert.Equal(t, int32(600), *service.Spec.SessionAffinityConfig.ClientIP.TimeoutSeconds)
+	assert.Equal(t, v1.IPFamilyPolicyPreferDualStack, *service.Spec.IPFamilyPolicy)
+	assert.Equal(t, []v1.IPFamily{v1.IPv6Protocol, v1.IPv4Protocol}, service.Spec.IPFamilies)
+
+	service, err = NewServiceSpec("db", "").WithHeadless().WithSelector("app", "db").Service("default")
+	assert.Nil(t, err)
+	assert.Equal(t, v1.ServiceTypeClusterIP, service.Spec.Type)
+	assert.Equal(t, v1.ClusterIPNone, service.Spec.ClusterIP)
+
+	service, err = NewServiceSpec("billing", "").WithExternalName("billing.example.com").Service("default")
+	assert.Nil(t, err)
+	assert.Equal(t, v1.ServiceTypeExternalName, service.Spec.Type)
+	assert.Equal(t, "billing.example.com", service.Spec.ExternalName)
+}
+
+func TestServiceSpecInvalid(t *testing.T) {
+	web := ServicePortSpec{Name: "web", Port: 80}
+	for name, spec := range map[string]*ServiceSpec{
+		"no name":                     NewServiceSpec("", "").WithPort(web),
+		"no ports":                    NewServiceSpec("web", ""),
+		"unnamed ports":               NewServiceSpec("web", "").WithPort(ServicePortSpec{Port: 80}).WithPort(ServicePortSpec{Port: 443}),
+		"duplicate port names":        NewServiceSpec("web", "").WithPort(web).WithPort(web),
+		"port out of range":           NewServiceSpec("web", "").WithPort(ServicePortSpec{Port: 70000}),
+		"unsupported protocol":        NewServiceSpec("web", "").WithPort(ServicePortSpec{Port: 80, Protocol: "ICMP"}),
+		"node port on ClusterIP":      NewServiceSpec("web", v1.ServiceTypeClusterIP).WithPort(ServicePortSpec{Port: 80, NodePort: 30080}),
+		"headless NodePort":           NewServiceSpec("web", v1.ServiceTypeNodePort).WithHeadless(),
+		"ExternalName without name":   NewServiceSpec("web", v1.ServiceTypeExternalName),
+		"ExternalName with selector":  NewServiceSpec("web", "").WithExternalName("example.com").WithSelector("app", "web"),
+		"traffic policy on ClusterIP": NewServiceSpec("web", "").WithPort(web).WithExternalTrafficPolicy(v1.ServiceExternalTrafficPolicyLocal),
+		"timeout without affinity":    NewServiceSpec("web", "").WithPort(web).WithSessionAffinity(v1.ServiceAffinityNone, 60),
+	} {
+		_, err := spec.Service("default")
+		assert.NotNil(t, err, name)
+	}
+}
+
+func TestFakeCreateServiceFromSpec(t *testing.T) {
+	cluster := newFakeCluster()
+	ctx := context.Background()
+
+	_, err := cluster.client.CreateServiceFromSpec(ctx, "default", NewServiceSpec("web", v1.ServiceTypeNodePort).
+		WithSelector("app", "web").
+		WithPort(ServicePortSpec{Name: "http", Port: 80, TargetPort: intstr.FromString("http")}).
+		WithPort(ServicePortSpec{Name: "metrics", Port: 9090}))
+	assert.Nil(t, err)
+	service, err := cluster.clientset.CoreV1().Services("default").Get(ctx, "web", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Len(t, service.Spec.Ports, 2)
+	assert.Equal(t, "http", service.Spec.Ports[0].TargetPort.StrVal)
+
+	_, err = cluster.client.CreateServiceFromSpec(ctx, "default", NewServiceSpec("broken", ""))
+	var objErr *ObjectError
+	assert.ErrorAs(t, err, &objErr)
+}
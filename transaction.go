@@ -0,0 +1,77 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+const rollbackTimeout = 30 * time.Second
+
+// step is one action of a transaction, undo reverts it after a later step failed.
+type step struct {
+	name string
+	do   func(ctx context.Context) error
+	undo func(ctx context.Context) error
+}
+
+// TransactionError describes which steps of a failed transaction succeeded,
+// which one failed and which were reverted.
+type TransactionError struct {
+	Succeeded   []string
+	Failed      string
+	Reverted    []string
+	Err         error // error of the failed step
+	RollbackErr error // steps that could not be reverted, nil when the rollback was clean
+}
+
+func (e *TransactionError) Error() string {
+	msg := fmt.Sprintf("%s failed: %v; succeeded: [%s]; reverted: [%s]", e.Failed, e.Err, strings.Join(e.Succeeded, ", "), strings.Join(e.Reverted, ", "))
+	if e.RollbackErr != nil {
+		msg += fmt.Sprintf("; rollback failed: %v", e.RollbackErr)
+	}
+	return msg
+}
+
+func (e *TransactionError) Unwrap() error {
+	return e.Err
+}
+
+// runSteps runs steps in order and stops on the first failure, reverting the
+// steps already done in reverse order. The rollback gets its own timeout as
+// ctx may be the reason the step failed.
+func runSteps(ctx context.Context, steps []step) error {
+	var done []step
+	for _, s := range steps {
+		err := s.do(ctx)
+		if err == nil {
+			done = append(done, s)
+			continue
+		}
+
+		txErr := &TransactionError{Failed: s.name, Err: err}
+		for _, d := range done {
+			txErr.Succeeded = append(txErr.Succeeded, d.name)
+		}
+
+		rollbackCtx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+		defer cancel()
+		var rollbackErrs []error
+		for i := len(done) - 1; i >= 0; i-- {
+			if done[i].undo == nil {
+				continue
+			}
+			if err := done[i].undo(rollbackCtx); err != nil {
+				rollbackErrs = append(rollbackErrs, fmt.Errorf("%s: %w", done[i].name, err))
+				continue
+			}
+			txErr.Reverted = append(txErr.Reverted, done[i].name)
+		}
+		txErr.RollbackErr = utilerrors.NewAggregate(rollbackErrs)
+		return txErr
+	}
+	return nil
+}
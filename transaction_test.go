@@ -0,0 +1,49 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunStepsRollsBack(t *testing.T) {
+	var calls []string
+	record := func(call string, err error) func(context.Context) error {
+		return func(context.Context) error {
+			calls = append(calls, call)
+			return err
+		}
+	}
+	boom := errors.New("boom")
+
+	err := runSteps(context.Background(), []step{
+		{name: "a", do: record("do a", nil), undo: record("undo a", nil)},
+		{name: "b", do: record("do b", nil), undo: record("undo b", errors.New("gone"))},
+		{name: "c", do: record("do c", boom), undo: record("undo c", nil)},
+		{name: "d", do: record("do d", nil), undo: record("undo d", nil)},
+	})
+
+	assert.Equal(t, []string{"do a", "do b", "do c", "undo b", "undo a"}, calls)
+	var txErr *TransactionError
+	assert.True(t, errors.As(err, &txErr))
+	assert.Equal(t, []string{"a", "b"}, txErr.Succeeded)
+	assert.Equal(t, "c", txErr.Failed)
+	assert.Equal(t, []string{"a"}, txErr.Reverted)
+	assert.NotNil(t, txErr.RollbackErr)
+	assert.ErrorIs(t, err, boom)
+}
+
+func TestRunStepsSuccess(t *testing.T) {
+	ran := 0
+	do := func(context.Context) error {
+		ran++
+		return nil
+	}
+
+	err := runSteps(context.Background(), []step{{name: "a", do: do}, {name: "b", do: do}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, ran)
+}